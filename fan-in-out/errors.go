@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Task that can fail, and should stop when the context is cancelled
+type TaskE[X any, Y any] = func(context.Context, X) (Y, error)
+
+// Per-index errors of a collect-all run
+type TaskErrors map[int]error
+
+func (e TaskErrors) Error() string {
+	indexes := make([]int, 0, len(e))
+	for index := range e {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	messages := make([]string, len(indexes))
+	for i, index := range indexes {
+		messages[i] = fmt.Sprintf("item %d: %v", index, e[index])
+	}
+	return fmt.Sprintf("%d tasks failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// FanOut with stride partitioning, for tasks that can fail
+// Workers stop taking items and close their channel when the context is cancelled
+func FanOutE[X any, Y any](ctx context.Context, items []X, task TaskE[X, Y], numWorkers int) []<-chan Output[Y] {
+	channels := make([]<-chan Output[Y], numWorkers)
+	indexes := Stride(len(items), numWorkers)
+
+	for workerID := range numWorkers {
+		workerCh := make(chan Output[Y])
+		channels[workerID] = workerCh
+
+		go func() {
+			defer close(workerCh)
+			for j := range indexes(workerID) {
+				if ctx.Err() != nil {
+					return
+				}
+				out, err := task(ctx, items[j])
+				select {
+				case workerCh <- Output[Y]{j, out, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return channels
+}
+
+// FanOutIn for tasks that can fail
+// failFast: the first error cancels all workers and is returned
+// Otherwise, all items are processed and the failed ones are returned as TaskErrors
+// Returns the context's cause if it is cancelled first; only returns after all workers have stopped
+func FanOutInE[X any, Y any](ctx context.Context, items []X, task TaskE[X, Y], numWorkers int, failFast bool) ([]Y, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	channels := FanOutE(ctx, items, task, numWorkers)
+	resultCh := FanIn(numWorkers, channels...)
+
+	results := make([]Y, len(items))
+	errs := make(TaskErrors)
+	for out := range resultCh {
+		if out.err == nil {
+			results[out.index] = out.item
+			continue
+		}
+		if !failFast {
+			errs[out.index] = out.err
+			continue
+		}
+		if len(errs) == 0 {
+			errs[out.index] = out.err
+			cancel(fmt.Errorf("item %d: %w", out.index, out.err))
+		}
+	}
+
+	if err := context.Cause(ctx); err != nil {
+		return results, err
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+func TestErrors() {
+	data := list.NumRange(1, 21)
+
+	// Fails on multiples of 7, stops early if cancelled
+	expandE := func(ctx context.Context, n int) (int, error) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return 0, context.Cause(ctx)
+		}
+		if n%7 == 0 {
+			return 0, fmt.Errorf("cannot expand %d", n)
+		}
+		return n * 11, nil
+	}
+
+	run(func() {
+		fmt.Println("Fail Fast")
+		results, err := FanOutInE(context.Background(), data, expandE, 4, true)
+		fmt.Println(results)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Collect All")
+		results, err := FanOutInE(context.Background(), data, expandE, 4, false)
+		fmt.Println(results)
+		fmt.Println("Error:", err)
+		var taskErrs TaskErrors
+		if errors.As(err, &taskErrs) {
+			fmt.Println("Failed items:", len(taskErrs))
+		}
+	})
+
+	run(func() {
+		fmt.Println("Timeout")
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		results, err := FanOutInE(ctx, data, expandE, 4, false)
+		fmt.Println(results)
+		fmt.Println("Error:", err)
+	})
+}
@@ -14,6 +14,7 @@ type Task[X any, Y any] = func(X) Y
 type Output[T any] struct {
 	index int
 	item  T
+	err   error
 }
 
 func expand(n int) int {
@@ -42,9 +43,14 @@ func FanOutIn[X any, Y any](items []X, task Task[X, Y], numWorkers int) []Y {
 	return results
 }
 
+// Stride partitioning, see FanOutWith for the other strategies
 func FanOut[X any, Y any](items []X, task Task[X, Y], numWorkers int) []<-chan Output[Y] {
+	return FanOutWith(items, task, numWorkers, Stride)
+}
+
+func FanOutWith[X any, Y any](items []X, task Task[X, Y], numWorkers int, strategy Strategy) []<-chan Output[Y] {
 	channels := make([]<-chan Output[Y], numWorkers)
-	numItems := len(items)
+	indexes := strategy(len(items), numWorkers)
 
 	// Fan-out the workload
 	for workerID := range numWorkers {
@@ -54,9 +60,9 @@ func FanOut[X any, Y any](items []X, task Task[X, Y], numWorkers int) []<-chan O
 		// start worker goroutine
 		go func() {
 			count := 0
-			for j := workerID; j < numItems; j += numWorkers {
+			for j := range indexes(workerID) {
 				out := task(items[j])
-				workerCh <- Output[Y]{j, out}
+				workerCh <- Output[Y]{j, out, nil}
 				count += 1
 			}
 			fmt.Printf("Worker %d finished %d tasks\n", workerID, count)
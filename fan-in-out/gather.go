@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Outcome of a scatter-gather call
+type Gather[Y any] struct {
+	Results   []Y             // winning results, in arrival order
+	Winners   []int           // task indexes of the winning results
+	Latencies []time.Duration // per task: until its result, error or cancellation
+	States    []string        // per task: won, lost, failed, cancelled
+}
+
+var errNotEnough = errors.New("not enough successful results")
+
+// Sends the input to all tasks (e.g. replicas), returns when the first k succeed
+// The remaining in-flight tasks are cancelled
+func FirstK[X any, Y any](ctx context.Context, input X, tasks []TaskE[X, Y], k int) (*Gather[Y], error) {
+	return scatterGather(ctx, input, tasks, k, func(received []Output[Y]) []Output[Y] {
+		if len(received) < k {
+			return nil
+		}
+		return received[:k]
+	})
+}
+
+// Sends the input to all tasks, returns when quorum tasks agree on the same result
+// The remaining in-flight tasks are cancelled
+func Quorum[X any, Y comparable](ctx context.Context, input X, tasks []TaskE[X, Y], quorum int) (*Gather[Y], error) {
+	return scatterGather(ctx, input, tasks, quorum, func(received []Output[Y]) []Output[Y] {
+		votes := make(map[Y][]Output[Y])
+		for _, out := range received {
+			votes[out.item] = append(votes[out.item], out)
+			if len(votes[out.item]) >= quorum {
+				return votes[out.item]
+			}
+		}
+		return nil
+	})
+}
+
+// Fans out one input to every task, and fans in the results until decide picks the winners
+// Fails early if fewer than need tasks can still succeed
+func scatterGather[X any, Y any](ctx context.Context, input X, tasks []TaskE[X, Y], need int, decide func([]Output[Y]) []Output[Y]) (*Gather[Y], error) {
+	numTasks := len(tasks)
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Scatter: one worker per task, buffered so that a cancelled task never blocks
+	start := time.Now()
+	channels := make([]<-chan Output[Y], numTasks)
+	for taskID, task := range tasks {
+		taskCh := make(chan Output[Y], 1)
+		channels[taskID] = taskCh
+		go func() {
+			out, err := task(ctx, input)
+			taskCh <- Output[Y]{taskID, out, err}
+			close(taskCh)
+		}()
+	}
+
+	g := &Gather[Y]{
+		Results:   make([]Y, 0),
+		Winners:   make([]int, 0),
+		Latencies: make([]time.Duration, numTasks),
+		States:    make([]string, numTasks),
+	}
+	received := make([]Output[Y], 0, numTasks)
+	var winners []Output[Y]
+	failed := 0
+
+	// Gather until decide picks the winners, too many tasks fail, or the parent is cancelled
+	// FanIn is buffered for every task, so the tasks still running never block after we return
+	resultCh := FanIn(numTasks, channels...)
+gather:
+	for range numTasks {
+		select {
+		case out := <-resultCh:
+			g.Latencies[out.index] = time.Since(start)
+			if out.err != nil {
+				g.States[out.index] = "failed"
+				failed += 1
+			} else {
+				g.States[out.index] = "lost"
+				received = append(received, out)
+			}
+			winners = decide(received)
+			if winners != nil || numTasks-failed < need {
+				break gather
+			}
+		case <-parentCtx.Done():
+			break gather
+		}
+	}
+
+	// Tasks still in flight are cancelled, with their latency at the time of the decision
+	cancel()
+	for taskID, state := range g.States {
+		if state == "" {
+			g.States[taskID] = "cancelled"
+			g.Latencies[taskID] = time.Since(start)
+		}
+	}
+
+	if err := parentCtx.Err(); err != nil {
+		return g, err
+	}
+	if winners == nil {
+		return g, fmt.Errorf("%w: need %d, %d of %d tasks failed", errNotEnough, need, failed, numTasks)
+	}
+	for _, out := range winners {
+		g.Results = append(g.Results, out.item)
+		g.Winners = append(g.Winners, out.index)
+		g.States[out.index] = "won"
+	}
+	return g, nil
+}
+
+func TestGather() {
+	// Replica with random latency, and optional wrong answer or failure
+	replica := func(name string, answer string, fails bool) TaskE[string, string] {
+		return func(ctx context.Context, query string) (string, error) {
+			latency := time.Duration(50+rand.IntN(300)) * time.Millisecond
+			select {
+			case <-time.After(latency):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			if fails {
+				return "", fmt.Errorf("%s unavailable", name)
+			}
+			return fmt.Sprintf("%s=%s", query, answer), nil
+		}
+	}
+	replicas := []TaskE[string, string]{
+		replica("r0", "42", false),
+		replica("r1", "42", false),
+		replica("r2", "41", false), // stale
+		replica("r3", "42", true),
+		replica("r4", "42", false),
+	}
+
+	display := func(g *Gather[string], err error) {
+		fmt.Println("Results:", g.Results, "Winners:", g.Winners)
+		for taskID, state := range g.States {
+			fmt.Printf("  task %d: %-9s %v\n", taskID, state, g.Latencies[taskID].Round(time.Millisecond))
+		}
+		fmt.Println("Error:", err)
+	}
+
+	run(func() {
+		fmt.Println("Fastest (first 1)")
+		display(FirstK(context.Background(), "answer", replicas, 1))
+	})
+
+	run(func() {
+		fmt.Println("First 2")
+		display(FirstK(context.Background(), "answer", replicas, 2))
+	})
+
+	run(func() {
+		fmt.Println("Quorum (3 of 5 agree)")
+		display(Quorum(context.Background(), "answer", replicas, 3))
+	})
+
+	run(func() {
+		fmt.Println("Fastest (a task that ignores cancellation)")
+		stubborn := func(_ context.Context, query string) (string, error) {
+			time.Sleep(3 * time.Second)
+			return query + "=slow", nil
+		}
+		fast := func(_ context.Context, query string) (string, error) {
+			return query + "=fast", nil
+		}
+		display(FirstK(context.Background(), "answer", []TaskE[string, string]{stubborn, fast}, 1))
+	})
+
+	run(func() {
+		fmt.Println("Quorum (impossible: 5 of 5)")
+		display(Quorum(context.Background(), "answer", replicas, 5))
+	})
+}
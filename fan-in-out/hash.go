@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Consistent-hash ring: each worker is placed on the ring at several virtual nodes,
+// and a key belongs to the first virtual node clockwise from the key's hash
+// Adding or removing one of N workers moves only about 1/N of the keys
+type Ring struct {
+	mu           sync.RWMutex
+	virtualNodes int
+	hashes       []uint64 // sorted
+	owners       map[uint64]int
+	workers      []int
+}
+
+// Key distribution of a partitioned fan-out
+type PartitionStats struct {
+	mu    sync.Mutex
+	items map[int]int
+	keys  map[int]map[string]bool
+}
+
+func NewRing(virtualNodes int, workers ...int) *Ring {
+	r := &Ring{
+		virtualNodes: virtualNodes,
+		hashes:       make([]uint64, 0),
+		owners:       make(map[uint64]int),
+		workers:      make([]int, 0),
+	}
+	for _, worker := range workers {
+		r.Add(worker)
+	}
+	return r
+}
+
+func (r *Ring) Add(worker int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.Contains(r.workers, worker) {
+		return
+	}
+	r.workers = append(r.workers, worker)
+	for v := range r.virtualNodes {
+		h := hashKey(fmt.Sprintf("worker-%d#%d", worker, v))
+		r.owners[h] = worker
+		r.hashes = append(r.hashes, h)
+	}
+	slices.Sort(r.hashes)
+}
+
+func (r *Ring) Remove(worker int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers = slices.DeleteFunc(r.workers, func(w int) bool {
+		return w == worker
+	})
+	r.hashes = slices.DeleteFunc(r.hashes, func(h uint64) bool {
+		if r.owners[h] != worker {
+			return false
+		}
+		delete(r.owners, h)
+		return true
+	})
+}
+
+// Copy of the ring, unaffected by later Add and Remove
+func (r *Ring) Snapshot() *Ring {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	owners := make(map[uint64]int, len(r.owners))
+	for h, worker := range r.owners {
+		owners[h] = worker
+	}
+	return &Ring{
+		virtualNodes: r.virtualNodes,
+		hashes:       slices.Clone(r.hashes),
+		owners:       owners,
+		workers:      slices.Clone(r.workers),
+	}
+}
+
+func (r *Ring) Workers() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.workers)
+}
+
+// Worker that owns the key, -1 if the ring is empty
+func (r *Ring) Get(key string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.hashes) == 0 {
+		return -1
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0 // wrap around
+	}
+	return r.owners[r.hashes[i]]
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// fnv alone clusters similar keys, finish with a mixer (splitmix64)
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// FanOut that routes each item to the worker owning its key, so a key always hits the same worker
+// newWorker creates each worker's task, so workers can hold per-key state (e.g. a cache)
+// Routes against a snapshot of the ring taken at the call; an empty ring gives no outputs
+func FanOutByKey[X any, Y any](items []X, key func(X) string, ring *Ring, newWorker func(workerID int) Task[X, Y]) ([]<-chan Output[Y], *PartitionStats) {
+	ring = ring.Snapshot()
+	workers := ring.Workers()
+	stats := &PartitionStats{
+		items: make(map[int]int),
+		keys:  make(map[int]map[string]bool),
+	}
+	if len(workers) == 0 {
+		return []<-chan Output[Y]{}, stats
+	}
+	inputs := make(map[int]chan Output[X])
+	channels := make([]<-chan Output[Y], len(workers))
+
+	for i, workerID := range workers {
+		inputCh := make(chan Output[X])
+		inputs[workerID] = inputCh
+		stats.keys[workerID] = make(map[string]bool)
+		workerCh := make(chan Output[Y])
+		channels[i] = workerCh
+
+		// start worker goroutine
+		go func() {
+			task := newWorker(workerID)
+			for input := range inputCh {
+				workerCh <- Output[Y]{input.index, task(input.item), nil}
+			}
+			close(workerCh)
+		}()
+	}
+
+	// Route the items by key
+	go func() {
+		for i, item := range items {
+			k := key(item)
+			workerID := ring.Get(k)
+			stats.mu.Lock()
+			stats.items[workerID] += 1
+			stats.keys[workerID][k] = true
+			stats.mu.Unlock()
+			inputs[workerID] <- Output[X]{i, item, nil}
+		}
+		for _, inputCh := range inputs {
+			close(inputCh)
+		}
+	}()
+	return channels, stats
+}
+
+func (s *PartitionStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workers := make([]int, 0, len(s.items))
+	for workerID := range s.keys {
+		workers = append(workers, workerID)
+	}
+	slices.Sort(workers)
+	out := ""
+	for _, workerID := range workers {
+		out += fmt.Sprintf("  worker %d: %d items, %d keys\n", workerID, s.items[workerID], len(s.keys[workerID]))
+	}
+	return out
+}
+
+func TestHash() {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d", i)
+	}
+
+	// Per-worker key counts, and the fraction of keys that changed owner
+	distribution := func(r *Ring) map[string]int {
+		owners := make(map[string]int, len(keys))
+		counts := make(map[int]int)
+		for _, key := range keys {
+			owners[key] = r.Get(key)
+			counts[owners[key]] += 1
+		}
+		for _, workerID := range r.Workers() {
+			fmt.Printf("  worker %d: %d keys\n", workerID, counts[workerID])
+		}
+		return owners
+	}
+	moved := func(before, after map[string]int) {
+		count := 0
+		for key, owner := range before {
+			if after[key] != owner {
+				count += 1
+			}
+		}
+		fmt.Printf("Moved: %d keys (%.1f%%)\n", count, 100*float64(count)/float64(len(keys)))
+	}
+
+	run(func() {
+		fmt.Println("Ring (4 workers, 100 virtual nodes)")
+		r := NewRing(100, 0, 1, 2, 3)
+		before := distribution(r)
+
+		fmt.Println("Add worker 4")
+		r.Add(4)
+		after := distribution(r)
+		moved(before, after)
+
+		fmt.Println("Remove worker 1")
+		r.Remove(1)
+		moved(after, distribution(r))
+	})
+
+	run(func() {
+		fmt.Println("Partitioned Fan-Out (per-worker cache)")
+		r := NewRing(100, 0, 1, 2)
+		requests := make([]string, 60)
+		for i := range requests {
+			requests[i] = fmt.Sprintf("user:%d", i%12)
+		}
+
+		// Worker with a cache: misses are expensive
+		var mu sync.Mutex
+		hits, misses := 0, 0
+		newWorker := func(workerID int) Task[string, string] {
+			cache := make(map[string]string)
+			return func(key string) string {
+				mu.Lock()
+				defer mu.Unlock()
+				if value, ok := cache[key]; ok {
+					hits += 1
+					return value
+				}
+				misses += 1
+				cache[key] = fmt.Sprintf("%s@%d", key, workerID)
+				return cache[key]
+			}
+		}
+
+		identity := func(key string) string {
+			return key
+		}
+		channels, stats := FanOutByKey(requests, identity, r, newWorker)
+		r.Add(3) // only affects later calls
+		results := make([]string, len(requests))
+		for out := range FanIn(len(channels), channels...) {
+			results[out.index] = out.item
+		}
+		fmt.Println(results[:12])
+		fmt.Print(stats)
+		fmt.Println("Cache hits:", hits, "misses:", misses)
+	})
+
+	run(func() {
+		fmt.Println("Empty Ring")
+		channels, _ := FanOutByKey([]string{"a", "b"}, func(key string) string {
+			return key
+		}, NewRing(100), func(int) Task[string, string] {
+			return func(key string) string { return key }
+		})
+		fmt.Println("Outputs:", len(channels))
+	})
+}
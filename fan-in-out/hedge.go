@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Hedged calls: the task starts on one backend, and a duplicate starts on the next backend
+// if no result arrives within the hedge delay, or right away if the first one fails;
+// the first success wins, the other is cancelled
+// The delay is fixed, or adaptive (p95 of the observed latencies)
+// The budget caps the hedges to a fraction of the calls, to limit the extra load
+type Hedger[X any, Y any] struct {
+	mu        sync.Mutex
+	backends  []TaskE[X, Y]
+	delay     time.Duration
+	adaptive  bool
+	budget    float64
+	latencies []time.Duration // recent attempts, for the adaptive delay
+	stats     HedgeStats
+}
+
+type HedgeStats struct {
+	Calls      int
+	Hedged     int // duplicates started
+	HedgeWon   int // hedging helped: the duplicate answered first, or after the primary failed
+	OverBudget int // hedges skipped because the budget was used up
+}
+
+const (
+	latencyWindow  = 100
+	adaptiveWarmup = 20
+)
+
+// Panics if there are no backends
+func NewHedger[X any, Y any](backends []TaskE[X, Y], delay time.Duration, budget float64) *Hedger[X, Y] {
+	if len(backends) == 0 {
+		panic("NewHedger: no backends")
+	}
+	return &Hedger[X, Y]{
+		backends:  backends,
+		delay:     delay,
+		budget:    budget,
+		latencies: make([]time.Duration, 0, latencyWindow),
+	}
+}
+
+// Uses the initial delay until enough latencies have been observed, then the p95
+func NewAdaptiveHedger[X any, Y any](backends []TaskE[X, Y], initialDelay time.Duration, budget float64) *Hedger[X, Y] {
+	h := NewHedger(backends, initialDelay, budget)
+	h.adaptive = true
+	return h
+}
+
+func (h *Hedger[X, Y]) Stats() HedgeStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// Current hedge delay
+func (h *Hedger[X, Y]) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hedgeDelay()
+}
+
+func (h *Hedger[X, Y]) Call(parentCtx context.Context, input X) (Y, error) {
+	ctx, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+
+	h.mu.Lock()
+	primary := h.stats.Calls % len(h.backends)
+	h.stats.Calls += 1
+	delay := h.hedgeDelay()
+	h.mu.Unlock()
+
+	// Buffered, so that the cancelled attempt never blocks
+	resultCh := make(chan Output[Y], 2)
+	attempt := func(backend int, hedge int) {
+		start := time.Now()
+		out, err := h.backends[backend](ctx, input)
+		if err == nil {
+			h.observe(time.Since(start))
+		} else if ctx.Err() != nil && parentCtx.Err() == nil {
+			// Cancelled because the other attempt won: its latency is censored (at least this long),
+			// but leaving it out would drift the adaptive delay lower
+			h.observe(time.Since(start))
+		}
+		resultCh <- Output[Y]{hedge, out, err}
+	}
+	go attempt(primary, 0)
+	running := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedgeCh := timer.C
+
+	// At most one hedge per call, subject to the budget
+	hedged := false
+	hedge := func() {
+		hedgeCh = nil
+		if hedged || len(h.backends) < 2 || ctx.Err() != nil {
+			return
+		}
+		hedged = true
+		if h.allowHedge() {
+			go attempt((primary+1)%len(h.backends), 1)
+			running += 1
+		}
+	}
+
+	var lastErr error
+	for running > 0 {
+		select {
+		case out := <-resultCh:
+			running -= 1
+			if out.err == nil {
+				if out.index == 1 {
+					h.mu.Lock()
+					h.stats.HedgeWon += 1
+					h.mu.Unlock()
+				}
+				return out.item, nil
+			}
+			lastErr = out.err
+			// Primary failed before the hedge delay: hedge right away
+			hedge()
+		case <-hedgeCh:
+			hedge()
+		}
+	}
+	var zero Y
+	return zero, lastErr
+}
+
+// Counts the hedge against the budget; caller must not hold the lock
+func (h *Hedger[X, Y]) allowHedge() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if float64(h.stats.Hedged+1) > h.budget*float64(h.stats.Calls) {
+		h.stats.OverBudget += 1
+		return false
+	}
+	h.stats.Hedged += 1
+	return true
+}
+
+func (h *Hedger[X, Y]) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) == latencyWindow {
+		h.latencies = h.latencies[1:]
+	}
+	h.latencies = append(h.latencies, latency)
+}
+
+// Caller must hold the lock
+func (h *Hedger[X, Y]) hedgeDelay() time.Duration {
+	if !h.adaptive || len(h.latencies) < adaptiveWarmup {
+		return h.delay
+	}
+	return percentile(h.latencies, 0.95)
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+func TestHedge() {
+	// Backend with a long tail: 10% of the calls are slow
+	backend := func(ctx context.Context, x int) (int, error) {
+		latency := time.Duration(20+rand.IntN(20)) * time.Millisecond
+		if rand.IntN(10) == 0 {
+			latency = 500 * time.Millisecond
+		}
+		select {
+		case <-time.After(latency):
+			return x * x, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	backends := []TaskE[int, int]{backend, backend, backend}
+
+	// 200 calls, 20 at a time
+	measure := func(h *Hedger[int, int]) {
+		var mu sync.Mutex
+		latencies := make([]time.Duration, 0)
+		var wg sync.WaitGroup
+		for worker := range 20 {
+			wg.Go(func() {
+				for x := worker; x < 200; x += 20 {
+					start := time.Now()
+					if _, err := h.Call(context.Background(), x); err != nil {
+						fmt.Println("Error:", err)
+					}
+					mu.Lock()
+					latencies = append(latencies, time.Since(start))
+					mu.Unlock()
+				}
+			})
+		}
+		wg.Wait()
+		round := func(d time.Duration) time.Duration {
+			return d.Round(time.Millisecond)
+		}
+		fmt.Printf("p50: %v, p95: %v, p99: %v\n", round(percentile(latencies, 0.5)), round(percentile(latencies, 0.95)), round(percentile(latencies, 0.99)))
+		stats := h.Stats()
+		fmt.Printf("Calls: %d, Hedged: %d, Helped: %d, Over budget: %d, Delay: %v\n", stats.Calls, stats.Hedged, stats.HedgeWon, stats.OverBudget, round(h.Delay()))
+	}
+
+	run(func() {
+		fmt.Println("No Hedging")
+		measure(NewHedger(backends, time.Hour, 0))
+	})
+
+	run(func() {
+		fmt.Println("Fixed Delay (50ms, budget 20%)")
+		measure(NewHedger(backends, 50*time.Millisecond, 0.2))
+	})
+
+	run(func() {
+		fmt.Println("Adaptive Delay (p95, budget 20%)")
+		measure(NewAdaptiveHedger(backends, 100*time.Millisecond, 0.2))
+	})
+
+	run(func() {
+		fmt.Println("Failing Primary (hedged right away)")
+		failing := func(ctx context.Context, x int) (int, error) {
+			return 0, fmt.Errorf("backend down")
+		}
+		h := NewHedger([]TaskE[int, int]{failing, backend}, time.Second, 1)
+		start := time.Now()
+		y, err := h.Call(context.Background(), 7)
+		fmt.Println("Result:", y, "Error:", err, "after", time.Since(start).Round(time.Millisecond))
+		fmt.Printf("%+v\n", h.Stats())
+	})
+
+	run(func() {
+		fmt.Println("Fixed Delay (50ms, budget 5%)")
+		measure(NewHedger(backends, 50*time.Millisecond, 0.05))
+	})
+}
@@ -8,7 +8,18 @@ import (
 )
 
 func main() {
-	TestFan()
+	// TestFan()
+	// TestWatchdog()
+	// TestStrategies()
+	// TestErrors()
+	// TestStream()
+	// TestOrdered()
+	// TestGather()
+	// TestHedge()
+	// TestMerger()
+	// TestPriority()
+	// TestHash()
+	TestMapReduce()
 }
 
 func run(task func()) {
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type KeyValue[K any, V any] struct {
+	Key   K
+	Value V
+}
+
+// MapReduce job: map each item to key/value pairs, optionally combine each mapper's pairs by key,
+// shuffle the pairs to reducers by key hash, and reduce the values of each key
+type Job[X any, K cmp.Ordered, V any, R any] struct {
+	mapFn       func(X) []KeyValue[K, V]
+	combineFn   func(K, []V) V
+	reduceFn    func(K, []V) R
+	numMappers  int
+	numReducers int
+	spillDir    string
+	spillLimit  int // pairs kept in memory per partition before spilling (0 = never)
+}
+
+type JobResult[K any, R any] struct {
+	Output   []KeyValue[K, R] // ordered by key
+	Map      time.Duration    // mappers, streaming their pairs into the partitions
+	Shuffle  time.Duration    // sorting what is left of each partition in memory
+	Reduce   time.Duration    // merging each partition's sorted runs, and reducing per key
+	Shuffled int              // pairs sent to the reducers
+	Spills   int              // spill files written
+}
+
+// Shuffle partition of one reducer: pairs in memory, and the sorted runs spilled to disk
+type partition[K any, V any] struct {
+	mu    sync.Mutex
+	pairs []KeyValue[K, V]
+	files []string
+}
+
+func NewJob[X any, K cmp.Ordered, V any, R any](mapFn func(X) []KeyValue[K, V], reduceFn func(K, []V) R, numMappers int, numReducers int) *Job[X, K, V, R] {
+	return &Job[X, K, V, R]{
+		mapFn:       mapFn,
+		reduceFn:    reduceFn,
+		numMappers:  numMappers,
+		numReducers: numReducers,
+	}
+}
+
+// Combines each mapper's values per key before the shuffle, to send fewer pairs
+func (j *Job[X, K, V, R]) WithCombiner(combineFn func(K, []V) V) *Job[X, K, V, R] {
+	j.combineFn = combineFn
+	return j
+}
+
+// Spills a partition to a temp file under dir when it holds more than limit pairs
+// Mappers also hand over their pairs every limit pairs, so memory stays bounded by the limit
+// Use "" for the default temp directory
+func (j *Job[X, K, V, R]) WithSpill(dir string, limit int) *Job[X, K, V, R] {
+	j.spillDir = dir
+	j.spillLimit = limit
+	return j
+}
+
+func (j *Job[X, K, V, R]) Run(ctx context.Context, items []X) (*JobResult[K, R], error) {
+	if j.numMappers <= 0 || j.numReducers <= 0 {
+		return nil, fmt.Errorf("invalid job: %d mappers, %d reducers", j.numMappers, j.numReducers)
+	}
+	result := &JobResult[K, R]{}
+
+	var dir string
+	var err error
+	if j.spillLimit > 0 {
+		dir, err = os.MkdirTemp(j.spillDir, "mapreduce")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+	}
+	partitions := make([]*partition[K, V], j.numReducers)
+	for reducerID := range partitions {
+		partitions[reducerID] = &partition[K, V]{}
+	}
+	var shuffled, spills atomic.Int64
+
+	// Hands the mapper's pairs to the reducer's partition, spilling it as a sorted run past the limit
+	send := func(reducerID int, pairs []KeyValue[K, V]) error {
+		if j.combineFn != nil {
+			combined := make([]KeyValue[K, V], 0)
+			for key, values := range groupByKey(pairs) {
+				combined = append(combined, KeyValue[K, V]{key, j.combineFn(key, values)})
+			}
+			pairs = combined
+		}
+		shuffled.Add(int64(len(pairs)))
+		p := partitions[reducerID]
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.pairs = append(p.pairs, pairs...)
+		if j.spillLimit > 0 && len(p.pairs) > j.spillLimit {
+			if err := spill(dir, p, reducerID); err != nil {
+				return err
+			}
+			spills.Add(1)
+		}
+		return nil
+	}
+
+	// Map: each mapper takes a contiguous chunk of the items,
+	// and streams its pairs to the partitions by key hash
+	start := time.Now()
+	chunks := make([][]X, j.numMappers)
+	indexes := Chunked(len(items), j.numMappers)
+	for mapperID := range j.numMappers {
+		for i := range indexes(mapperID) {
+			chunks[mapperID] = append(chunks[mapperID], items[i])
+		}
+	}
+	_, err = FanOutInE(ctx, chunks, func(ctx context.Context, chunk []X) (struct{}, error) {
+		buffers := make([][]KeyValue[K, V], j.numReducers)
+		for _, item := range chunk {
+			if err := ctx.Err(); err != nil {
+				return struct{}{}, err
+			}
+			for _, pair := range j.mapFn(item) {
+				reducerID := int(hashKey(fmt.Sprint(pair.Key)) % uint64(j.numReducers))
+				buffers[reducerID] = append(buffers[reducerID], pair)
+				if j.spillLimit > 0 && len(buffers[reducerID]) >= j.spillLimit {
+					if err := send(reducerID, buffers[reducerID]); err != nil {
+						return struct{}{}, err
+					}
+					buffers[reducerID] = nil
+				}
+			}
+		}
+		for reducerID, pairs := range buffers {
+			if len(pairs) == 0 {
+				continue
+			}
+			if err := send(reducerID, pairs); err != nil {
+				return struct{}{}, err
+			}
+		}
+		return struct{}{}, nil
+	}, j.numMappers, true)
+	if err != nil {
+		return nil, err
+	}
+	result.Map = time.Since(start)
+	result.Shuffled = int(shuffled.Load())
+	result.Spills = int(spills.Load())
+
+	// Shuffle: sort what is left in memory, as each partition's last run
+	start = time.Now()
+	for _, p := range partitions {
+		sortByKey(p.pairs)
+	}
+	result.Shuffle = time.Since(start)
+
+	// Reduce: each reducer merges its sorted runs, and reduces one key at a time
+	start = time.Now()
+	reduced, err := FanOutInE(ctx, partitions, func(ctx context.Context, p *partition[K, V]) ([]KeyValue[K, R], error) {
+		runs := []*sortedRun[K, V]{{pairs: p.pairs}}
+		defer func() {
+			for _, r := range runs {
+				r.close()
+			}
+		}()
+		for _, path := range p.files {
+			r, err := openSpill[K, V](path)
+			if err != nil {
+				return nil, err
+			}
+			runs = append(runs, r)
+		}
+		for _, r := range runs {
+			if err := r.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		output := make([]KeyValue[K, R], 0)
+		for {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			// Smallest key at the head of the runs, ordered like sortByKey (a NaN key equals itself)
+			var key K
+			found := false
+			for _, r := range runs {
+				if r.ok && (!found || cmp.Compare(r.head.Key, key) < 0) {
+					key, found = r.head.Key, true
+				}
+			}
+			if !found {
+				return output, nil
+			}
+			values := make([]V, 0)
+			for _, r := range runs {
+				for r.ok && cmp.Compare(r.head.Key, key) == 0 {
+					values = append(values, r.head.Value)
+					if err := r.advance(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			output = append(output, KeyValue[K, R]{key, j.reduceFn(key, values)})
+		}
+	}, j.numReducers, true)
+	if err != nil {
+		return nil, err
+	}
+	result.Output = slices.Concat(reduced...)
+	sortByKey(result.Output)
+	result.Reduce = time.Since(start)
+	return result, nil
+}
+
+// Sorts the partition's pairs and writes them to a new spill file as a run, and empties the partition
+// Pairs are encoded one at a time, so the reducer can stream them back
+// Caller must hold the partition's lock
+func spill[K cmp.Ordered, V any](dir string, p *partition[K, V], reducerID int) error {
+	path := filepath.Join(dir, fmt.Sprintf("partition-%d-%d.gob", reducerID, len(p.files)))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	sortByKey(p.pairs)
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for _, pair := range p.pairs {
+		if err := encoder.Encode(pair); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	p.files = append(p.files, path)
+	p.pairs = nil
+	return nil
+}
+
+// Run of pairs sorted by key, read from memory or streamed from a spill file
+type sortedRun[K any, V any] struct {
+	pairs   []KeyValue[K, V]
+	file    *os.File
+	decoder *gob.Decoder
+	head    KeyValue[K, V]
+	ok      bool // head is valid
+}
+
+func openSpill[K any, V any](path string) (*sortedRun[K, V], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &sortedRun[K, V]{file: file, decoder: gob.NewDecoder(bufio.NewReader(file))}, nil
+}
+
+// Moves the head to the next pair, ok is false once the run is exhausted
+func (r *sortedRun[K, V]) advance() error {
+	if r.decoder == nil {
+		r.ok = len(r.pairs) > 0
+		if r.ok {
+			r.head, r.pairs = r.pairs[0], r.pairs[1:]
+		}
+		return nil
+	}
+	var pair KeyValue[K, V]
+	err := r.decoder.Decode(&pair)
+	if errors.Is(err, io.EOF) {
+		r.ok = false
+		return nil
+	}
+	if err != nil {
+		r.ok = false
+		return fmt.Errorf("invalid spill %s: %w", r.file.Name(), err)
+	}
+	r.head, r.ok = pair, true
+	return nil
+}
+
+func (r *sortedRun[K, V]) close() {
+	if r.file != nil {
+		r.file.Close()
+	}
+}
+
+func sortByKey[K cmp.Ordered, V any](pairs []KeyValue[K, V]) {
+	slices.SortFunc(pairs, func(a, b KeyValue[K, V]) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+}
+
+func groupByKey[K comparable, V any](pairs []KeyValue[K, V]) map[K][]V {
+	groups := make(map[K][]V)
+	for _, pair := range pairs {
+		groups[pair.Key] = append(groups[pair.Key], pair.Value)
+	}
+	return groups
+}
+
+func TestMapReduce() {
+	lines := []string{
+		"the quick brown fox jumps over the lazy dog",
+		"the dog barks and the fox runs",
+		"a quick brown dog and a lazy fox",
+		"over and over the fox jumps",
+	}
+	// Bigger input: repeat the lines
+	text := make([]string, 0)
+	for range 500 {
+		text = append(text, lines...)
+	}
+
+	wordCount := func(line string) []KeyValue[string, int] {
+		words := strings.Fields(line)
+		pairs := make([]KeyValue[string, int], len(words))
+		for i, word := range words {
+			pairs[i] = KeyValue[string, int]{word, 1}
+		}
+		return pairs
+	}
+	sum := func(_ string, counts []int) int {
+		total := 0
+		for _, count := range counts {
+			total += count
+		}
+		return total
+	}
+
+	display := func(result *JobResult[string, int], err error) {
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, pair := range result.Output {
+			fmt.Printf("%s:%d ", pair.Key, pair.Value)
+		}
+		fmt.Println()
+		fmt.Printf("Shuffled: %d pairs, Spills: %d\n", result.Shuffled, result.Spills)
+		fmt.Printf("Map: %v, Shuffle: %v, Reduce: %v\n", result.Map, result.Shuffle, result.Reduce)
+	}
+
+	run(func() {
+		fmt.Println("Word Count")
+		display(NewJob(wordCount, sum, 4, 3).Run(context.Background(), text))
+	})
+
+	run(func() {
+		fmt.Println("Word Count (combiner)")
+		display(NewJob(wordCount, sum, 4, 3).WithCombiner(sum).Run(context.Background(), text))
+	})
+
+	run(func() {
+		fmt.Println("Word Count (spill every 2000 pairs)")
+		display(NewJob(wordCount, sum, 4, 3).WithSpill("", 2000).Run(context.Background(), text))
+	})
+
+	run(func() {
+		fmt.Println("Longest Line per First Word")
+		firstWord := func(line string) []KeyValue[string, string] {
+			return []KeyValue[string, string]{{strings.Fields(line)[0], line}}
+		}
+		longest := func(_ string, lines []string) int {
+			length := 0
+			for _, line := range lines {
+				length = max(length, len(line))
+			}
+			return length
+		}
+		display(NewJob(firstWord, longest, 2, 2).Run(context.Background(), lines))
+	})
+
+	run(func() {
+		fmt.Println("Float Keys (with NaN)")
+		readings := []float64{1.5, math.NaN(), 2.5, 1.5, math.NaN()}
+		byValue := func(x float64) []KeyValue[float64, int] {
+			return []KeyValue[float64, int]{{x, 1}}
+		}
+		count := func(_ float64, counts []int) int {
+			return len(counts)
+		}
+		result, err := NewJob(byValue, count, 2, 2).WithSpill("", 1).Run(context.Background(), readings)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println(result.Output)
+	})
+
+	run(func() {
+		fmt.Println("No Reducers")
+		display(NewJob(wordCount, sum, 4, 0).Run(context.Background(), text))
+	})
+}
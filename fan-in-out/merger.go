@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FanIn whose sources can be added and removed while the merged output stays open
+// The output closes only after Close, once every remaining source has drained
+type Merger[T any] struct {
+	mu      sync.Mutex
+	output  chan T
+	sources map[<-chan T]*mergeSource
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+type mergeSource struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	errMergerClosed = errors.New("merger is closed")
+	errSourceExists = errors.New("source already added")
+)
+
+func NewMerger[T any](bufferSize int) *Merger[T] {
+	return &Merger[T]{
+		output:  make(chan T, bufferSize),
+		sources: make(map[<-chan T]*mergeSource),
+	}
+}
+
+func (m *Merger[T]) Output() <-chan T {
+	return m.output
+}
+
+// Number of attached sources
+func (m *Merger[T]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sources)
+}
+
+// Attaches the source; it is forwarded until it is closed or removed
+func (m *Merger[T]) Add(channel <-chan T) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errMergerClosed
+	}
+	if _, ok := m.sources[channel]; ok {
+		return errSourceExists
+	}
+	source := &mergeSource{make(chan struct{}), make(chan struct{})}
+	m.sources[channel] = source
+	m.wg.Go(func() {
+		defer close(source.done)
+		defer m.detach(channel)
+		for {
+			select {
+			case item, ok := <-channel:
+				if !ok {
+					return
+				}
+				// Remove must not wait on the output reader
+				select {
+				case m.output <- item:
+				case <-source.stop:
+					return
+				}
+			case <-source.stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Detaches the source, without draining it (it still belongs to its producer)
+// Returns once the source's forwarder has stopped, without waiting on the output reader:
+// an item received from the source but not yet forwarded is dropped
+// Returns false if the source is not attached
+func (m *Merger[T]) Remove(channel <-chan T) bool {
+	m.mu.Lock()
+	source, ok := m.sources[channel]
+	if ok {
+		delete(m.sources, channel)
+		close(source.stop)
+	}
+	m.mu.Unlock()
+	if ok {
+		<-source.done
+	}
+	return ok
+}
+
+// No more sources can be added; the output closes once the attached sources are drained or removed
+func (m *Merger[T]) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	go func() {
+		m.wg.Wait()
+		close(m.output)
+	}()
+}
+
+func (m *Merger[T]) detach(channel <-chan T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sources, channel)
+}
+
+func TestMerger() {
+	start := time.Now()
+
+	// Connection that sends count messages at intervals, then closes
+	connect := func(name string, count int, interval time.Duration) <-chan string {
+		channel := make(chan string)
+		go func() {
+			defer close(channel)
+			for i := range count {
+				time.Sleep(interval)
+				channel <- fmt.Sprintf("%s#%d", name, i)
+			}
+		}()
+		return channel
+	}
+
+	run(func() {
+		fmt.Println("Dynamic Merger")
+		m := NewMerger[string](0)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for message := range m.Output() {
+				fmt.Printf("%4dms %s\n", time.Since(start).Milliseconds(), message)
+			}
+			fmt.Printf("%4dms output closed\n", time.Since(start).Milliseconds())
+		}()
+
+		conn1 := connect("conn1", 100, 100*time.Millisecond) // long-lived
+		m.Add(conn1)
+		m.Add(connect("conn2", 3, 150*time.Millisecond))
+
+		time.Sleep(300 * time.Millisecond)
+		fmt.Println("Add conn3")
+		m.Add(connect("conn3", 4, 120*time.Millisecond))
+
+		time.Sleep(300 * time.Millisecond)
+		fmt.Println("Remove conn1:", m.Remove(conn1), "sources:", m.Len())
+		go func() {
+			// Removed source still belongs to its producer
+			for range conn1 {
+			}
+		}()
+
+		fmt.Println("Close")
+		m.Close()
+		fmt.Println("Add after close:", m.Add(make(chan string)))
+		<-done
+	})
+	run(func() {
+		fmt.Println("Remove from the Reader")
+		m := NewMerger[string](0)
+		conn := connect("conn", 5, 10*time.Millisecond)
+		m.Add(conn)
+		fmt.Println("Received:", <-m.Output())
+		time.Sleep(50 * time.Millisecond) // forwarder is blocked on the next send
+		fmt.Println("Remove conn:", m.Remove(conn), "sources:", m.Len())
+		go func() {
+			for range conn {
+			}
+		}()
+		m.Close()
+		for message := range m.Output() {
+			fmt.Println("Received:", message)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// FanIn that emits items strictly in index order (0, 1, 2, ...), as soon as the next index arrives
+// Each source channel must be in increasing index order (true for all FanOut strategies)
+// Holds at most bufferSize out-of-order items per source; a source that is that far ahead waits
+// bufferSize is at least 1 (smaller values are raised to 1), so the total buffer is at most
+// max(bufferSize, 1) * len(channels) items
+// Sources should stop on the same context, since their channels are not drained on cancellation
+func OrderedFanIn[T any](ctx context.Context, bufferSize int, channels ...<-chan Output[T]) <-chan Output[T] {
+	bufferSize = max(bufferSize, 1)
+	type tagged struct {
+		source int
+		out    Output[T]
+	}
+
+	// Per-source credits bound the reorder buffer
+	mergedCh := make(chan tagged)
+	credits := make([]chan struct{}, len(channels))
+	var wg sync.WaitGroup
+	for source, workerCh := range channels {
+		credits[source] = make(chan struct{}, bufferSize)
+		for range bufferSize {
+			credits[source] <- struct{}{}
+		}
+		wg.Go(func() {
+			for out := range workerCh {
+				select {
+				case <-credits[source]:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case mergedCh <- tagged{source, out}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(mergedCh)
+	}()
+
+	outputCh := make(chan Output[T])
+	go func() {
+		defer close(outputCh)
+		next := 0
+		pending := make(map[int]tagged)
+		send := func(t tagged) bool {
+			credits[t.source] <- struct{}{}
+			select {
+			case outputCh <- t.out:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			var t tagged
+			var ok bool
+			select {
+			case t, ok = <-mergedCh:
+			case <-ctx.Done():
+				return
+			}
+			if !ok {
+				break
+			}
+			pending[t.out.index] = t
+			for {
+				t, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if !send(t) {
+					return
+				}
+				next += 1
+			}
+		}
+		// Flush leftovers (indices after a gap)
+		indexes := make([]int, 0, len(pending))
+		for index := range pending {
+			indexes = append(indexes, index)
+		}
+		slices.Sort(indexes)
+		for _, index := range indexes {
+			if !send(pending[index]) {
+				return
+			}
+		}
+	}()
+	return outputCh
+}
+
+// K-way merge of source channels that are each sorted by the comparator
+// Emits the smallest head among the sources; output is re-indexed in merged order
+func MergeSorted[T any](ctx context.Context, compare func(T, T) int, channels ...<-chan Output[T]) <-chan Output[T] {
+	outputCh := make(chan Output[T])
+	go func() {
+		defer close(outputCh)
+		receive := func(source int) (Output[T], bool) {
+			select {
+			case out, ok := <-channels[source]:
+				return out, ok
+			case <-ctx.Done():
+				return Output[T]{}, false
+			}
+		}
+
+		// Needs the head of every source before it can emit
+		h := &mergeHeap[T]{compare: compare}
+		for source := range channels {
+			if out, ok := receive(source); ok {
+				h.heads = append(h.heads, mergeHead[T]{source, out})
+			}
+		}
+		heap.Init(h)
+
+		index := 0
+		for h.Len() > 0 {
+			head := heap.Pop(h).(mergeHead[T])
+			select {
+			case outputCh <- Output[T]{index, head.out.item, head.out.err}:
+			case <-ctx.Done():
+				return
+			}
+			index += 1
+			if out, ok := receive(head.source); ok {
+				heap.Push(h, mergeHead[T]{head.source, out})
+			}
+		}
+	}()
+	return outputCh
+}
+
+type mergeHead[T any] struct {
+	source int
+	out    Output[T]
+}
+
+type mergeHeap[T any] struct {
+	heads   []mergeHead[T]
+	compare func(T, T) int
+}
+
+func (h *mergeHeap[T]) Len() int {
+	return len(h.heads)
+}
+
+func (h *mergeHeap[T]) Less(i, j int) bool {
+	return h.compare(h.heads[i].out.item, h.heads[j].out.item) < 0
+}
+
+func (h *mergeHeap[T]) Swap(i, j int) {
+	h.heads[i], h.heads[j] = h.heads[j], h.heads[i]
+}
+
+func (h *mergeHeap[T]) Push(x any) {
+	h.heads = append(h.heads, x.(mergeHead[T]))
+}
+
+func (h *mergeHeap[T]) Pop() any {
+	last := len(h.heads) - 1
+	head := h.heads[last]
+	h.heads = h.heads[:last]
+	return head
+}
+
+func TestOrdered() {
+	data := list.NumRange(1, 13)
+	ctx := context.Background()
+
+	// Random cost, so results finish out of order
+	jitter := func(x int) int {
+		time.Sleep(time.Duration(50+rand.IntN(400)) * time.Millisecond)
+		return x * 11
+	}
+
+	display := func(resultCh <-chan Output[int]) {
+		results := make([]string, 0)
+		for out := range resultCh {
+			results = append(results, fmt.Sprintf("%d:%d", out.index, out.item))
+		}
+		fmt.Println(results)
+	}
+
+	run(func() {
+		fmt.Println("FanIn (arrival order)")
+		display(FanIn(4, FanOutWith(data, jitter, 4, Dynamic)...))
+	})
+
+	run(func() {
+		fmt.Println("Ordered FanIn (buffer 2)")
+		display(OrderedFanIn(ctx, 2, FanOutWith(data, jitter, 4, Dynamic)...))
+	})
+
+	run(func() {
+		fmt.Println("Ordered FanIn (buffer 0, raised to 1)")
+		display(OrderedFanIn(ctx, 0, FanOutWith(data, jitter, 4, Dynamic)...))
+	})
+
+	run(func() {
+		fmt.Println("K-way Merge")
+		sorted := func(items ...int) <-chan Output[int] {
+			outputCh := make(chan Output[int])
+			go func() {
+				defer close(outputCh)
+				for i, item := range items {
+					time.Sleep(time.Duration(rand.IntN(50)) * time.Millisecond)
+					outputCh <- Output[int]{i, item, nil}
+				}
+			}()
+			return outputCh
+		}
+		display(MergeSorted(ctx, cmp.Compare[int],
+			sorted(1, 4, 9, 16, 25),
+			sorted(2, 3, 5, 7, 11, 13),
+			sorted(10, 20, 30),
+		))
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Source channel of a priority or weighted FanIn
+type Source[T any] struct {
+	Name     string
+	Channel  <-chan T
+	Priority int // strict priority: higher goes first
+	Weight   int // weighted: share of the output, relative to the other weights
+}
+
+// Items forwarded per source
+type FanInCounters struct {
+	mu     sync.Mutex
+	names  []string
+	counts []int
+}
+
+func (c *FanInCounters) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := 0
+	for _, count := range c.counts {
+		total += count
+	}
+	parts := make([]string, len(c.names))
+	for i, name := range c.names {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(c.counts[i]) / float64(total)
+		}
+		parts[i] = fmt.Sprintf("%s: %d (%.1f%%)", name, c.counts[i], share)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Drains higher-priority sources first
+// Starvation protection: a ready source that has been passed over starveLimit times in a row
+// is served next (0 turns it off)
+func PriorityFanIn[T any](ctx context.Context, starveLimit int, sources ...Source[T]) (<-chan T, *FanInCounters) {
+	skipped := make([]int, len(sources))
+	return selectFanIn(ctx, sources, func(ready []int) int {
+		pick := ready[0]
+		for _, s := range ready {
+			if sources[s].Priority > sources[pick].Priority {
+				pick = s
+			}
+		}
+		if starveLimit > 0 {
+			for _, s := range ready {
+				if skipped[s] >= starveLimit && skipped[s] > skipped[pick] {
+					pick = s
+				}
+			}
+		}
+		for _, s := range ready {
+			skipped[s] += 1
+		}
+		skipped[pick] = 0
+		return pick
+	})
+}
+
+// Interleaves the ready sources by weight (smooth weighted round-robin)
+// Every source with a positive weight gets its share, so none starves
+func WeightedFanIn[T any](ctx context.Context, sources ...Source[T]) (<-chan T, *FanInCounters) {
+	current := make([]int, len(sources))
+	return selectFanIn(ctx, sources, func(ready []int) int {
+		total := 0
+		pick := ready[0]
+		for _, s := range ready {
+			current[s] += sources[s].Weight
+			total += sources[s].Weight
+			if current[s] > current[pick] {
+				pick = s
+			}
+		}
+		current[pick] -= total
+		return pick
+	})
+}
+
+// Keeps the head item of each source, and lets pick choose among the sources with a head
+// Blocks on all open sources only when no head is ready
+func selectFanIn[T any](ctx context.Context, sources []Source[T], pick func(ready []int) int) (<-chan T, *FanInCounters) {
+	counters := &FanInCounters{
+		names:  make([]string, len(sources)),
+		counts: make([]int, len(sources)),
+	}
+	for i, source := range sources {
+		counters.names[i] = source.Name
+	}
+
+	outputCh := make(chan T)
+	go func() {
+		defer close(outputCh)
+		heads := make([]*T, len(sources))
+		open := make([]bool, len(sources))
+		for i := range sources {
+			open[i] = true
+		}
+		receive := func(s int, item T, ok bool) {
+			if ok {
+				heads[s] = &item
+			} else {
+				open[s] = false
+			}
+		}
+
+		for {
+			// Fill the heads that are immediately available
+			for s, source := range sources {
+				if heads[s] != nil || !open[s] {
+					continue
+				}
+				select {
+				case item, ok := <-source.Channel:
+					receive(s, item, ok)
+				default:
+				}
+			}
+
+			ready := make([]int, 0, len(sources))
+			for s := range sources {
+				if heads[s] != nil {
+					ready = append(ready, s)
+				}
+			}
+
+			if len(ready) == 0 {
+				// Nothing ready: wait for any open source, or cancellation
+				cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+				indexes := []int{-1}
+				for s, source := range sources {
+					if open[s] {
+						cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(source.Channel)})
+						indexes = append(indexes, s)
+					}
+				}
+				if len(indexes) == 1 {
+					return // all sources closed
+				}
+				chosen, value, ok := reflect.Select(cases)
+				if chosen == 0 {
+					return
+				}
+				var item T
+				if ok {
+					item = value.Interface().(T)
+				}
+				receive(indexes[chosen], item, ok)
+				continue
+			}
+
+			s := pick(ready)
+			counters.mu.Lock()
+			counters.counts[s] += 1
+			counters.mu.Unlock()
+			select {
+			case outputCh <- *heads[s]:
+			case <-ctx.Done():
+				return
+			}
+			heads[s] = nil
+		}
+	}()
+	return outputCh, counters
+}
+
+func TestPriority() {
+	// Backlogged queue: always has an item ready, until it runs out
+	backlog := func(name string, count int) <-chan string {
+		channel := make(chan string, count)
+		for i := range count {
+			channel <- fmt.Sprintf("%s%d", name, i)
+		}
+		close(channel)
+		return channel
+	}
+
+	take := func(outputCh <-chan string, n int) []string {
+		items := make([]string, 0, n)
+		for item := range outputCh {
+			items = append(items, item)
+			if len(items) == n {
+				break
+			}
+		}
+		return items
+	}
+
+	run(func() {
+		fmt.Println("Strict Priority (control before bulk)")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		control := make(chan string, 3)
+		control <- "stop"
+		control <- "pause"
+		control <- "resume"
+		outputCh, counters := PriorityFanIn(ctx, 0,
+			Source[string]{Name: "bulk", Channel: backlog("b", 1000), Priority: 0},
+			Source[string]{Name: "control", Channel: control, Priority: 10},
+		)
+		fmt.Println(take(outputCh, 8))
+		fmt.Println(counters)
+	})
+
+	run(func() {
+		fmt.Println("Strict Priority (starvation)")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		outputCh, counters := PriorityFanIn(ctx, 0,
+			Source[string]{Name: "high", Channel: backlog("h", 1000), Priority: 1},
+			Source[string]{Name: "low", Channel: backlog("l", 1000), Priority: 0},
+		)
+		take(outputCh, 1000)
+		fmt.Println(counters)
+	})
+
+	run(func() {
+		fmt.Println("Strict Priority (starvation limit 4)")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		outputCh, counters := PriorityFanIn(ctx, 4,
+			Source[string]{Name: "high", Channel: backlog("h", 1000), Priority: 1},
+			Source[string]{Name: "low", Channel: backlog("l", 1000), Priority: 0},
+		)
+		fmt.Println(take(outputCh, 10))
+		take(outputCh, 990)
+		fmt.Println(counters)
+	})
+
+	run(func() {
+		fmt.Println("Weighted (5:3:1)")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		outputCh, counters := WeightedFanIn(ctx,
+			Source[string]{Name: "a", Channel: backlog("a", 1000), Weight: 5},
+			Source[string]{Name: "b", Channel: backlog("b", 1000), Weight: 3},
+			Source[string]{Name: "c", Channel: backlog("c", 1000), Weight: 1},
+		)
+		fmt.Println(take(outputCh, 9))
+		take(outputCh, 891)
+		fmt.Println(counters)
+	})
+}
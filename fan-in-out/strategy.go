@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"sync/atomic"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Assigns the item indexes to the workers:
+// given the number of items and workers, returns the indexes each worker processes
+type Strategy = func(numItems int, numWorkers int) func(workerID int) iter.Seq[int]
+
+// Worker w takes indexes w, w+n, w+2n, ...
+// Static: a worker that gets the slow items finishes last while the others sit idle
+func Stride(numItems int, numWorkers int) func(int) iter.Seq[int] {
+	return func(workerID int) iter.Seq[int] {
+		return func(yield func(int) bool) {
+			for j := workerID; j < numItems; j += numWorkers {
+				if !yield(j) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Worker w takes one contiguous chunk of indexes (cache-friendly)
+// Static: chunk sizes differ by at most one
+func Chunked(numItems int, numWorkers int) func(int) iter.Seq[int] {
+	return func(workerID int) iter.Seq[int] {
+		return func(yield func(int) bool) {
+			size, extra := numItems/numWorkers, numItems%numWorkers
+			start := workerID*size + min(workerID, extra)
+			end := start + size
+			if workerID < extra {
+				end += 1
+			}
+			for j := start; j < end; j++ {
+				if !yield(j) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Workers pull the next unclaimed index from a shared counter
+// Dynamic: free workers keep taking items, so slow items do not pile up on one worker
+func Dynamic(numItems int, numWorkers int) func(int) iter.Seq[int] {
+	var next atomic.Int64
+	return func(workerID int) iter.Seq[int] {
+		return func(yield func(int) bool) {
+			for {
+				j := int(next.Add(1) - 1)
+				if j >= numItems || !yield(j) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestStrategies() {
+	data := list.NumRange(1, 17)
+	strategies := []struct {
+		name     string
+		strategy Strategy
+	}{
+		{"Stride", Stride},
+		{"Chunked", Chunked},
+		{"Dynamic", Dynamic},
+	}
+
+	// Skewed workloads: slow items every 4th item, or clustered at the end
+	sleeper := func(slow func(int) bool) Task[int, int] {
+		return func(x int) int {
+			if slow(x) {
+				time.Sleep(400 * time.Millisecond)
+			} else {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return x * x
+		}
+	}
+	workloads := []struct {
+		name string
+		task Task[int, int]
+	}{
+		{"Periodic", sleeper(func(x int) bool { return x%4 == 0 })},
+		{"Clustered", sleeper(func(x int) bool { return x > 12 })},
+	}
+
+	for _, workload := range workloads {
+		run(func() {
+			fmt.Printf("%s Workload\n", workload.name)
+			timings := make([]string, 0, len(strategies))
+			for _, s := range strategies {
+				start := time.Now()
+				channels := FanOutWith(data, workload.task, 4, s.strategy)
+				results := make([]int, len(data))
+				for out := range FanIn(4, channels...) {
+					results[out.index] = out.item
+				}
+				elapsed := time.Since(start).Round(time.Millisecond)
+				timings = append(timings, fmt.Sprintf("%-8s %v", s.name, elapsed))
+			}
+			for _, timing := range timings {
+				fmt.Println(timing)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Compares the FanOut strategies on skewed workloads:
+//
+//	go test -bench Strategies -run '^$'
+func BenchmarkStrategies(b *testing.B) {
+	data := make([]int, 64)
+	for i := range data {
+		data[i] = i + 1
+	}
+	strategies := []struct {
+		name     string
+		strategy Strategy
+	}{
+		{"Stride", Stride},
+		{"Chunked", Chunked},
+		{"Dynamic", Dynamic},
+	}
+
+	// Slow items cost 8x the others
+	sleeper := func(slow func(int) bool) Task[int, int] {
+		return func(x int) int {
+			if slow(x) {
+				time.Sleep(4 * time.Millisecond)
+			} else {
+				time.Sleep(500 * time.Microsecond)
+			}
+			return x * x
+		}
+	}
+	workloads := []struct {
+		name string
+		task Task[int, int]
+	}{
+		{"Uniform", sleeper(func(int) bool { return false })},
+		{"Periodic", sleeper(func(x int) bool { return x%4 == 0 })},
+		{"Clustered", sleeper(func(x int) bool { return x > 48 })},
+	}
+
+	for _, workload := range workloads {
+		for _, s := range strategies {
+			b.Run(workload.name+"/"+s.name, func(b *testing.B) {
+				for b.Loop() {
+					for range FanIn(4, FanOutWith(data, workload.task, 4, s.strategy)...) {
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FanOut over a channel of unknown length
+// Items are numbered in arrival order (the Output index), and go to whichever worker is free
+// Workers stop and close their channel when the input is closed or the context is cancelled
+func FanOutStream[X any, Y any](ctx context.Context, inputCh <-chan X, task Task[X, Y], numWorkers int) []<-chan Output[Y] {
+	// Dispatcher: assigns sequence numbers
+	jobCh := make(chan Output[X])
+	go func() {
+		defer close(jobCh)
+		index := 0
+		for {
+			select {
+			case item, ok := <-inputCh:
+				if !ok {
+					return
+				}
+				select {
+				case jobCh <- Output[X]{index, item, nil}:
+				case <-ctx.Done():
+					return
+				}
+				index += 1
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	channels := make([]<-chan Output[Y], numWorkers)
+	for workerID := range numWorkers {
+		workerCh := make(chan Output[Y])
+		channels[workerID] = workerCh
+
+		go func() {
+			defer close(workerCh)
+			for job := range jobCh {
+				out := task(job.item)
+				select {
+				case workerCh <- Output[Y]{job.index, out, nil}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return channels
+}
+
+// Streaming FanOut + FanIn: results come out in completion order, tagged with the sequence number
+func FanOutInStream[X any, Y any](ctx context.Context, inputCh <-chan X, task Task[X, Y], numWorkers int) <-chan Output[Y] {
+	return FanIn(numWorkers, FanOutStream(ctx, inputCh, task, numWorkers)...)
+}
+
+func TestStream() {
+	// Producer of unknown length: emits numbers at intervals
+	produce := func(ctx context.Context, count int, interval time.Duration) <-chan int {
+		outputCh := make(chan int)
+		go func() {
+			defer close(outputCh)
+			for n := 1; n <= count; n++ {
+				select {
+				case outputCh <- n:
+				case <-ctx.Done():
+					return
+				}
+				time.Sleep(interval)
+			}
+		}()
+		return outputCh
+	}
+
+	run(func() {
+		fmt.Println("Streaming Fan-Out/Fan-In")
+		ctx := context.Background()
+		for out := range FanOutInStream(ctx, produce(ctx, 10, 200*time.Millisecond), expand, 4) {
+			fmt.Printf("#%d: %d\n", out.index, out.item)
+		}
+	})
+
+	run(func() {
+		fmt.Println("Middle of a Pipeline (cancelled)")
+		ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+		defer cancel()
+
+		// produce -> expand (fan-out/in) -> format
+		expandedCh := FanOutInStream(ctx, produce(ctx, 100, 100*time.Millisecond), expand, 4)
+		formatCh := make(chan string)
+		go func() {
+			defer close(formatCh)
+			for out := range expandedCh {
+				formatCh <- fmt.Sprintf("<%d:%d>", out.index, out.item)
+			}
+		}()
+		count := 0
+		for line := range formatCh {
+			fmt.Println(line)
+			count += 1
+		}
+		fmt.Println("Received:", count, "Error:", ctx.Err())
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+	"github.com/roidaradal/go-patterns/watchdog"
+)
+
+// FanOutIn, with each worker channel watched by the watchdog
+// Returns the partial results and the cause if the context is cancelled (e.g. StallError)
+func WatchedFanOutIn[X any, Y any](ctx context.Context, w *watchdog.Watchdog, items []X, task Task[X, Y], numWorkers int) ([]Y, error) {
+	channels := FanOut(items, task, numWorkers)
+	for workerID, workerCh := range channels {
+		channels[workerID] = watchdog.Watch(w, fmt.Sprintf("worker %d", workerID), workerCh)
+	}
+	resultCh := FanIn(numWorkers, channels...)
+
+	results := make([]Y, len(items))
+	for {
+		select {
+		case out, ok := <-resultCh:
+			if !ok {
+				return results, nil
+			}
+			results[out.index] = out.item
+		case <-ctx.Done():
+			return results, context.Cause(ctx)
+		}
+	}
+}
+
+func TestWatchdog() {
+	data := list.NumRange(1, 13)
+
+	// Expand that hangs on 7, waiting on a channel nobody sends to
+	stuckExpand := func(n int) int {
+		if n == 7 {
+			<-make(chan struct{})
+		}
+		return expand(n)
+	}
+
+	run(func() {
+		fmt.Println("Watched Fan-Out/Fan-In (fail fast)")
+		w := watchdog.New(2*time.Second, true)
+		ctx, stop := w.Start(context.Background())
+		defer stop()
+		results, err := WatchedFanOutIn(ctx, w, data, stuckExpand, 4)
+		fmt.Println(len(results), results)
+		fmt.Println("Error:", err)
+	})
+}
@@ -5,6 +5,7 @@ go 1.25.3
 require (
 	github.com/roidaradal/fn v0.4.19
 	golang.org/x/sync v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Branches do not drop items: the dispatcher blocks until every target branch
+// has accepted the item, so a slow branch slows down the whole split (backpressure).
+// bufferSize gives each branch some slack to absorb bursts.
+// All branch outputs must be consumed concurrently (e.g. with Merge), otherwise
+// a branch that is not being read will eventually block the others.
+
+// Sends every item to both pipes
+func Tee[X any, Y any, Z any](a PipeFn[X, Y], b PipeFn[X, Z], bufferSize int) func(<-chan Data[X]) (<-chan Data[Y], <-chan Data[Z]) {
+	return func(inputCh <-chan Data[X]) (<-chan Data[Y], <-chan Data[Z]) {
+		branches := dispatch(inputCh, 2, bufferSize, func(Data[X]) []int {
+			return []int{0, 1}
+		})
+		return a(branches[0]), b(branches[1])
+	}
+}
+
+// Sends every item to all pipes
+func Broadcast[X any, Y any](bufferSize int, pipes ...PipeFn[X, Y]) func(<-chan Data[X]) []<-chan Data[Y] {
+	targets := list.NumRange(0, len(pipes))
+	return func(inputCh <-chan Data[X]) []<-chan Data[Y] {
+		branches := dispatch(inputCh, len(pipes), bufferSize, func(Data[X]) []int {
+			return targets
+		})
+		outputs := make([]<-chan Data[Y], len(pipes))
+		for i, pipe := range pipes {
+			outputs[i] = pipe(branches[i])
+		}
+		return outputs
+	}
+}
+
+// Sends each item to exactly one pipe: route(item) mod len(pipes)
+// Use a key hash as the route to partition by key
+// Panics if there are no pipes
+func Partition[X any, Y any](route func(X) int, bufferSize int, pipes ...PipeFn[X, Y]) func(<-chan Data[X]) []<-chan Data[Y] {
+	if len(pipes) == 0 {
+		panic("Partition: no pipes")
+	}
+	numPipes := len(pipes)
+	return func(inputCh <-chan Data[X]) []<-chan Data[Y] {
+		branches := dispatch(inputCh, numPipes, bufferSize, func(data Data[X]) []int {
+			if data.err != nil {
+				return []int{0} // errored items have no item to route
+			}
+			target := route(data.item) % numPipes
+			if target < 0 {
+				target += numPipes
+			}
+			return []int{target}
+		})
+		outputs := make([]<-chan Data[Y], numPipes)
+		for i, pipe := range pipes {
+			outputs[i] = pipe(branches[i])
+		}
+		return outputs
+	}
+}
+
+// Sends items that pass the predicate to the yes pipe, the rest to the no pipe
+func Split[X any, Y any](pred func(X) bool, yes PipeFn[X, Y], no PipeFn[X, Y], bufferSize int) func(<-chan Data[X]) (<-chan Data[Y], <-chan Data[Y]) {
+	route := func(item X) int {
+		if pred(item) {
+			return 0
+		}
+		return 1
+	}
+	return func(inputCh <-chan Data[X]) (<-chan Data[Y], <-chan Data[Y]) {
+		outputs := Partition(route, bufferSize, yes, no)(inputCh)
+		return outputs[0], outputs[1]
+	}
+}
+
+// Joins disjoint branches (e.g. from Partition or Split) back into one channel
+// Indices are kept as-is, since each input index appears in only one branch
+// (as long as the branch stages preserve the index)
+func Merge[T any](channels ...<-chan Data[T]) <-chan Data[T] {
+	return mergeWith(channels, func(_ int, data Data[T]) Data[T] {
+		return data
+	})
+}
+
+// Joins overlapping branches (e.g. from Tee or Broadcast) back into one channel
+// The same input index appears in every branch, so the index is remapped
+// to index * numBranches + branch: items from different branches never collide,
+// and the outputs for the same input stay next to each other in index order
+func Interleave[T any](channels ...<-chan Data[T]) <-chan Data[T] {
+	numBranches := len(channels)
+	return mergeWith(channels, func(branch int, data Data[T]) Data[T] {
+		return Data[T]{data.index*numBranches + branch, data.item, data.err}
+	})
+}
+
+// Distributes each input item to the branches returned by targets
+func dispatch[T any](inputCh <-chan Data[T], numBranches int, bufferSize int, targets func(Data[T]) []int) []chan Data[T] {
+	branches := make([]chan Data[T], numBranches)
+	for i := range numBranches {
+		branches[i] = make(chan Data[T], bufferSize)
+	}
+	go func() {
+		for input := range inputCh {
+			for _, target := range targets(input) {
+				branches[target] <- input
+			}
+		}
+		for _, branch := range branches {
+			close(branch)
+		}
+	}()
+	return branches
+}
+
+func mergeWith[T any](channels []<-chan Data[T], remap func(int, Data[T]) Data[T]) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	var wg sync.WaitGroup
+	for branch, channel := range channels {
+		wg.Go(func() {
+			for data := range channel {
+				outputCh <- remap(branch, data)
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+func TestBranch() {
+	data := list.NumRange(1, 11)
+
+	run(func() {
+		fmt.Println("Tee")
+		format := Pipe(func(x int) string {
+			return fmt.Sprintf("<%d>", x)
+		})
+		squares, texts := Tee(Pipe(square), format, 0)(Generate(data...))
+		var out []int
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			out = Collect(squares)
+		})
+		fmt.Println(Collect(texts))
+		wg.Wait()
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Broadcast + Interleave")
+		outputs := Broadcast(2, Pipe(square), Pipe(double), Pipe(increment))(Generate(data...))
+		out := Collect(Interleave(outputs...))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Partition + Merge")
+		byRemainder := func(x int) int { return x % 3 }
+		outputs := Partition(byRemainder, 2, Pipe(square), Pipe(double), Pipe(increment))(Generate(data...))
+		out := Collect(Merge(outputs...))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Split + Merge")
+		isEven := func(x int) bool { return x%2 == 0 }
+		evens, odds := Split(isEven, Pipe(square), Pipe(increment), 0)(Generate(data...))
+		out := Collect(Merge(evens, odds))
+		fmt.Println(out)
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+type SinkFn[T any] = func(<-chan Data[T]) error
+
+// Named pipeline stage, the name is used for logs and metrics
+type Stage[X any, Y any] struct {
+	name string
+	pipe PipeFn[X, Y]
+}
+
+// Pipeline of stages, from input type X to output type Y
+type Pipeline[X any, Y any] struct {
+	stages []string
+	pipe   PipeFn[X, Y]
+}
+
+func NewStage[X any, Y any](name string, fn TransformFn[X, Y]) Stage[X, Y] {
+	return NamedPipe(name, Pipe(fn))
+}
+
+// Wraps any PipeFn (e.g. an operator) as a named stage
+func NamedPipe[X any, Y any](name string, pipe PipeFn[X, Y]) Stage[X, Y] {
+	return Stage[X, Y]{name, pipe}
+}
+
+// Composes two PipeFns into one: output of a is fed to b
+func Compose[X any, Y any, Z any](a PipeFn[X, Y], b PipeFn[Y, Z]) PipeFn[X, Z] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Z] {
+		return b(a(inputCh))
+	}
+}
+
+// Composes two stages into one stage, named "a -> b"
+func ComposeStages[X any, Y any, Z any](a Stage[X, Y], b Stage[Y, Z]) Stage[X, Z] {
+	name := fmt.Sprintf("%s -> %s", a.name, b.name)
+	return Stage[X, Z]{name, Compose(a.pipe, b.pipe)}
+}
+
+func NewPipeline[X any, Y any](stage Stage[X, Y]) *Pipeline[X, Y] {
+	return &Pipeline[X, Y]{
+		stages: []string{stage.name},
+		pipe:   logStage(stage),
+	}
+}
+
+// Returns a new pipeline with a stage of the same input and output type appended;
+// the receiver is unchanged, so it can be extended in different ways
+// Methods cannot have type parameters, so use Extend for type-changing stages
+func (p *Pipeline[X, Y]) Then(stage Stage[Y, Y]) *Pipeline[X, Y] {
+	return Extend(p, stage)
+}
+
+// Appends a stage that changes the output type of the pipeline
+func Extend[X any, Y any, Z any](p *Pipeline[X, Y], stage Stage[Y, Z]) *Pipeline[X, Z] {
+	stages := append(slices.Clone(p.stages), stage.name)
+	return &Pipeline[X, Z]{
+		stages: stages,
+		pipe:   Compose(p.pipe, logStage(stage)),
+	}
+}
+
+func (p *Pipeline[X, Y]) Stages() []string {
+	return slices.Clone(p.stages)
+}
+
+func (p *Pipeline[X, Y]) String() string {
+	return strings.Join(p.stages, " -> ")
+}
+
+// Runs the pipeline: feeds the source to the stages, and the output to the sink
+// If the context is cancelled, the source stops being forwarded and the stages wind down
+// The first errored item (e.g. a source read error) stops the run and is returned
+// Run only returns after all stages have finished, so no goroutines are leaked;
+// the source must be finite or stop on its own when the context is cancelled
+func (p *Pipeline[X, Y]) Run(ctx context.Context, source <-chan Data[X], sink SinkFn[Y]) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inputCh := make(chan Data[X])
+	go func() {
+		defer close(inputCh)
+		for data := range source {
+			select {
+			case inputCh <- data:
+			case <-runCtx.Done():
+				// Drain the source so its goroutine can exit
+				for range source {
+				}
+				return
+			}
+		}
+	}()
+
+	// Intercept errored items: keep the first error and stop the run
+	var firstErr error
+	outputCh := make(chan Data[Y])
+	go func() {
+		for data := range p.pipe(inputCh) {
+			if data.err != nil {
+				if firstErr == nil {
+					firstErr = data.err
+					cancel()
+				}
+				continue
+			}
+			outputCh <- data
+		}
+		close(outputCh)
+	}()
+
+	err := sink(outputCh)
+
+	// Sink may return early: stop the source and drain the stages
+	cancel()
+	for range outputCh {
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err != nil {
+		return err
+	}
+	return context.Cause(ctx)
+}
+
+// Logs the number of items and running time of the stage when it finishes
+func logStage[X any, Y any](stage Stage[X, Y]) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		start := time.Now()
+		stageCh := stage.pipe(inputCh)
+		outputCh := make(chan Data[Y])
+		go func() {
+			count := 0
+			for data := range stageCh {
+				outputCh <- data
+				count += 1
+			}
+			fmt.Printf("[%s] Finished %d items in %v\n", stage.name, count, time.Since(start))
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+func TestBuilder() {
+	data := list.NumRange(1, 11)
+
+	run(func() {
+		fmt.Println("Compose")
+		pipe := Compose(Compose(Pipe(square), Pipe(double)), Pipe(increment))
+		out := Collect(pipe(Generate(data...)))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Pipeline Builder")
+		p := NewPipeline(NewStage("square", square)).
+			Then(NewStage("double", double)).
+			Then(NewStage("increment", increment))
+
+		format := NewStage("format", func(x int) string {
+			return fmt.Sprintf("<%d>", x)
+		})
+		q := Extend(p, format)
+		fmt.Println("Stages:", q)
+
+		// Branching off the same base leaves the base unchanged
+		base := NewPipeline(NewStage("square", square))
+		fmt.Println("Branches:", base.Then(NewStage("double", double)), "|", base.Then(NewStage("increment", increment)), "| base:", base)
+
+		var out []string
+		err := q.Run(context.Background(), Generate(data...), func(outputCh <-chan Data[string]) error {
+			out = Collect(outputCh)
+			return nil
+		})
+		fmt.Println(out)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Pipeline with Timeout")
+		p := NewPipeline(ComposeStages(NewStage("square", square), NewStage("double", double)))
+		ctx, cancel := context.WithTimeout(context.Background(), 450*time.Millisecond)
+		defer cancel()
+
+		var out []int
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			out = Collect(outputCh)
+			return nil
+		})
+		fmt.Println(out)
+		fmt.Println("Error:", err)
+	})
+}
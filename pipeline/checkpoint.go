@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Checkpoint keeps track of the highest contiguous index fully consumed by the sink,
+// and persists it to a local file at intervals
+// On restart with the same source, Resume skips the indices that were already processed
+// The stages between the source and the sink must preserve the index (e.g. Pipe, Scan)
+type Checkpoint struct {
+	mu       sync.Mutex
+	path     string
+	interval time.Duration
+	next     int          // all indices before next have been acknowledged
+	acked    map[int]bool // acknowledged indices after a gap
+	saved    int          // value of next at the last save
+	lastSave time.Time
+}
+
+type checkpointFile struct {
+	Last    int       `json:"last"`
+	Updated time.Time `json:"updated"`
+}
+
+// Loads the checkpoint from the file, or starts fresh if the file does not exist
+func LoadCheckpoint(path string, interval time.Duration) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:     path,
+		interval: interval,
+		acked:    make(map[int]bool),
+		lastSave: time.Now(),
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved checkpointFile
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	c.next = saved.Last + 1
+	c.saved = c.next
+	return c, nil
+}
+
+// Highest contiguous index that has been acknowledged, -1 if none
+func (c *Checkpoint) Last() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.next - 1
+}
+
+// Marks the index as fully consumed
+// Persists the checkpoint if the interval has passed since the last save
+func (c *Checkpoint) Ack(index int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < c.next {
+		return nil
+	}
+	c.acked[index] = true
+	for c.acked[c.next] {
+		delete(c.acked, c.next)
+		c.next += 1
+	}
+	if time.Since(c.lastSave) < c.interval {
+		return nil
+	}
+	return c.save()
+}
+
+// Persists the checkpoint now
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Checkpoint) save() error {
+	c.lastSave = time.Now()
+	if c.next == c.saved {
+		return nil
+	}
+	content, err := json.Marshal(checkpointFile{c.next - 1, c.lastSave})
+	if err != nil {
+		return err
+	}
+	_, err = atomicWrite(c.path, func(w io.Writer) (int, error) {
+		return w.Write(content)
+	})
+	if err == nil {
+		c.saved = c.next
+	}
+	return err
+}
+
+// Skips the items of the source that are already covered by the checkpoint
+func Resume[T any](c *Checkpoint, source <-chan Data[T]) <-chan Data[T] {
+	last := c.Last()
+	outputCh := make(chan Data[T])
+	go func() {
+		for data := range source {
+			if data.err == nil && data.index <= last {
+				continue
+			}
+			outputCh <- data
+		}
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+// Sink that runs fn for each item, and only acknowledges the item after fn succeeds
+// Stops at the first error (the rest are drained), and saves the checkpoint at the end
+func Acknowledged[T any](c *Checkpoint, fn func(T) error) SinkFn[T] {
+	return func(channel <-chan Data[T]) error {
+		var firstErr error
+		for data := range channel {
+			if firstErr != nil {
+				continue
+			}
+			if data.err != nil {
+				firstErr = data.err
+				continue
+			}
+			if err := fn(data.item); err != nil {
+				firstErr = err
+				continue
+			}
+			if err := c.Ack(data.index); err != nil {
+				firstErr = err
+			}
+		}
+		if err := c.Save(); firstErr == nil {
+			firstErr = err
+		}
+		return firstErr
+	}
+}
+
+func TestCheckpoint() {
+	ctx := context.Background()
+	data := list.NumRange(1, 11)
+	p := NewPipeline(NewStage("square", square))
+
+	dir, err := os.MkdirTemp("", "pipeline")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "squares.checkpoint")
+
+	runWith := func(crashAt int) {
+		c, err := LoadCheckpoint(path, 250*time.Millisecond)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Resume after index:", c.Last())
+		err = p.Run(ctx, Resume(c, Generate(data...)), Acknowledged(c, func(x int) error {
+			if x == crashAt {
+				return fmt.Errorf("crashed at %d", x)
+			}
+			fmt.Println("Consumed:", x)
+			return nil
+		}))
+		fmt.Println("Error:", err)
+		fmt.Println("Checkpoint:", c.Last())
+	}
+
+	run(func() {
+		fmt.Println("First Run (crash)")
+		runWith(49)
+	})
+
+	run(func() {
+		fmt.Println("Second Run (resume)")
+		runWith(0)
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is injectable, so that time-based stages can be run deterministically
+type Clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Clock that only moves when Advance is called
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []manualTimer
+}
+
+type manualTimer struct {
+	deadline time.Time
+	channel  chan time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channel := make(chan time.Time, 1)
+	deadline := c.now.Add(d)
+	if d <= 0 {
+		channel <- c.now
+	} else {
+		c.timers = append(c.timers, manualTimer{deadline, channel})
+	}
+	return channel
+}
+
+// Moves the clock forward, firing the timers that are due
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := make([]manualTimer, 0, len(c.timers))
+	for _, timer := range c.timers {
+		if timer.deadline.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.channel <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// Waits until at least n timers are pending
+// Used to make sure a stage is already waiting, before advancing the clock
+func (c *ManualClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		count := len(c.timers)
+		c.mu.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
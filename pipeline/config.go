@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+// Registry of named sources, transforms and sinks, that graph configs can refer to
+// Graphs run on Data[any] channels; items are converted back to the registered types
+// at each node, and the config is type-checked against the registered types before running
+type Registry struct {
+	sources map[string]*sourceEntry
+	stages  map[string]*stageEntry
+	sinks   map[string]*sinkEntry
+}
+
+type sourceEntry struct {
+	output reflect.Type
+	build  func(context.Context) <-chan Data[any]
+}
+
+type stageEntry struct {
+	input    reflect.Type
+	output   reflect.Type
+	parallel bool // can run on multiple workers
+	build    func(parallelism int) PipeFn[any, any]
+}
+
+type sinkEntry struct {
+	input reflect.Type
+	sink  SinkFn[any]
+}
+
+// Pipeline graph config: sources feed stages, stages feed other stages or sinks
+// A node with several consumers broadcasts its output to all of them;
+// a node with several inputs receives them interleaved (see Interleave)
+type GraphConfig struct {
+	Name    string       `json:"name" yaml:"name"`
+	Sources []NodeConfig `json:"sources" yaml:"sources"`
+	Stages  []NodeConfig `json:"stages" yaml:"stages"`
+	Sinks   []NodeConfig `json:"sinks" yaml:"sinks"`
+}
+
+type NodeConfig struct {
+	ID          string   `json:"id" yaml:"id"`
+	Use         string   `json:"use" yaml:"use"` // registered name, defaults to the ID
+	Inputs      []string `json:"inputs" yaml:"inputs"`
+	Parallelism int      `json:"parallelism" yaml:"parallelism"`
+	Buffer      int      `json:"buffer" yaml:"buffer"` // output buffer size
+}
+
+// Validated pipeline graph, ready to run
+type Graph struct {
+	name     string
+	registry *Registry
+	nodes    map[string]*graphNode
+	order    []string // topological order
+}
+
+type nodeKind string
+
+const (
+	sourceNode nodeKind = "source"
+	stageNode  nodeKind = "stage"
+	sinkNode   nodeKind = "sink"
+)
+
+type graphNode struct {
+	NodeConfig
+	kind      nodeKind
+	input     reflect.Type
+	output    reflect.Type
+	consumers []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sources: make(map[string]*sourceEntry),
+		stages:  make(map[string]*stageEntry),
+		sinks:   make(map[string]*sinkEntry),
+	}
+}
+
+func RegisterSource[T any](r *Registry, name string, source func(context.Context) <-chan Data[T]) {
+	r.sources[name] = &sourceEntry{
+		output: reflect.TypeFor[T](),
+		build: func(ctx context.Context) <-chan Data[any] {
+			return toAny(source(ctx))
+		},
+	}
+}
+
+func RegisterTransform[X any, Y any](r *Registry, name string, fn TransformFn[X, Y]) {
+	r.stages[name] = &stageEntry{
+		input:    reflect.TypeFor[X](),
+		output:   reflect.TypeFor[Y](),
+		parallel: true,
+		build: func(parallelism int) PipeFn[any, any] {
+			pipe := Pipe(fn)
+			if parallelism > 1 {
+				pipe = ParallelPipe(fn, parallelism)
+			}
+			return func(inputCh <-chan Data[any]) <-chan Data[any] {
+				return toAny(pipe(fromAny[X](inputCh)))
+			}
+		},
+	}
+}
+
+// Registers any PipeFn (e.g. an operator) as a stage; it always runs on one worker
+func RegisterPipe[X any, Y any](r *Registry, name string, pipe PipeFn[X, Y]) {
+	r.stages[name] = &stageEntry{
+		input:  reflect.TypeFor[X](),
+		output: reflect.TypeFor[Y](),
+		build: func(int) PipeFn[any, any] {
+			return func(inputCh <-chan Data[any]) <-chan Data[any] {
+				return toAny(pipe(fromAny[X](inputCh)))
+			}
+		},
+	}
+}
+
+func RegisterSink[T any](r *Registry, name string, sink SinkFn[T]) {
+	r.sinks[name] = &sinkEntry{
+		input: reflect.TypeFor[T](),
+		sink: func(inputCh <-chan Data[any]) error {
+			return sink(fromAny[T](inputCh))
+		},
+	}
+}
+
+// Loads the graph config from a .json, .yaml or .yml file, and validates it
+func LoadGraph(r *Registry, path string) (*Graph, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.TrimPrefix(filepath.Ext(path), ".")
+	return ParseGraph(r, content, format)
+}
+
+// Parses the graph config (format: json, yaml or yml), and validates it
+// Unknown fields in the config are rejected
+func ParseGraph(r *Registry, content []byte, format string) (*Graph, error) {
+	var cfg GraphConfig
+	switch strings.ToLower(format) {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("invalid graph config: %w", err)
+		}
+	case "yaml", "yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("invalid graph config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown graph config format: %q", format)
+	}
+	return NewGraph(r, cfg)
+}
+
+// Validates the graph config against the registry: unknown names, missing or
+// invalid inputs, type mismatches between connected nodes, unused outputs and cycles
+// All problems found are returned together
+func NewGraph(r *Registry, cfg GraphConfig) (*Graph, error) {
+	g := &Graph{
+		name:     cfg.Name,
+		registry: r,
+		nodes:    make(map[string]*graphNode),
+	}
+	errs := make([]error, 0)
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Nodes: resolve the registered names and types
+	ids := make([]string, 0)
+	addNodes := func(kind nodeKind, configs []NodeConfig) {
+		for _, nodeCfg := range configs {
+			node := &graphNode{NodeConfig: nodeCfg, kind: kind}
+			if node.ID == "" {
+				fail("%s with no id", kind)
+				continue
+			}
+			if _, exists := g.nodes[node.ID]; exists {
+				fail("%s %q: duplicate id", kind, node.ID)
+				continue
+			}
+			if node.Use == "" {
+				node.Use = node.ID
+			}
+			if node.Parallelism < 0 || node.Buffer < 0 {
+				fail("%s %q: parallelism and buffer cannot be negative", kind, node.ID)
+			}
+			switch kind {
+			case sourceNode:
+				if entry, ok := r.sources[node.Use]; ok {
+					node.output = entry.output
+				} else {
+					fail("source %q: unknown source %q", node.ID, node.Use)
+				}
+				if len(node.Inputs) > 0 {
+					fail("source %q: sources cannot have inputs", node.ID)
+				}
+			case stageNode:
+				if entry, ok := r.stages[node.Use]; ok {
+					node.input, node.output = entry.input, entry.output
+					if node.Parallelism > 1 && !entry.parallel {
+						fail("stage %q: %q cannot run in parallel", node.ID, node.Use)
+					}
+				} else {
+					fail("stage %q: unknown stage %q", node.ID, node.Use)
+				}
+			case sinkNode:
+				if entry, ok := r.sinks[node.Use]; ok {
+					node.input = entry.input
+				} else {
+					fail("sink %q: unknown sink %q", node.ID, node.Use)
+				}
+				if node.Buffer > 0 {
+					fail("sink %q: sinks have no output buffer", node.ID)
+				}
+			}
+			if kind != sourceNode && len(node.Inputs) == 0 {
+				fail("%s %q: no inputs", kind, node.ID)
+			}
+			g.nodes[node.ID] = node
+			ids = append(ids, node.ID)
+		}
+	}
+	addNodes(sourceNode, cfg.Sources)
+	addNodes(stageNode, cfg.Stages)
+	addNodes(sinkNode, cfg.Sinks)
+
+	// Edges: check the inputs and the types
+	for _, id := range ids {
+		node := g.nodes[id]
+		for i, inputID := range node.Inputs {
+			if slices.Contains(node.Inputs[:i], inputID) {
+				fail("%s %q: duplicate input %q", node.kind, id, inputID)
+				continue
+			}
+			producer, ok := g.nodes[inputID]
+			if !ok {
+				fail("%s %q: unknown input %q", node.kind, id, inputID)
+				continue
+			}
+			if producer.kind == sinkNode {
+				fail("%s %q: input %q is a sink", node.kind, id, inputID)
+				continue
+			}
+			producer.consumers = append(producer.consumers, id)
+			if producer.output != nil && node.input != nil && !producer.output.AssignableTo(node.input) {
+				fail("%s %q: input %q produces %v, but %q expects %v", node.kind, id, inputID, producer.output, node.Use, node.input)
+			}
+		}
+	}
+	for _, id := range ids {
+		node := g.nodes[id]
+		if node.kind != sinkNode && len(node.consumers) == 0 {
+			fail("%s %q: output is not consumed", node.kind, id)
+		}
+	}
+
+	// Order: topological sort, leftover nodes are in a cycle
+	inDegree := make(map[string]int)
+	for _, id := range ids {
+		inDegree[id] = 0
+	}
+	for _, id := range ids {
+		for _, consumer := range g.nodes[id].consumers {
+			inDegree[consumer] += 1
+		}
+	}
+	queue := make([]string, 0)
+	for _, id := range ids {
+		if inDegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		g.order = append(g.order, id)
+		for _, consumer := range g.nodes[id].consumers {
+			inDegree[consumer] -= 1
+			if inDegree[consumer] == 0 {
+				queue = append(queue, consumer)
+			}
+		}
+	}
+	if len(g.order) < len(ids) {
+		cycle := make([]string, 0)
+		for _, id := range ids {
+			if inDegree[id] > 0 {
+				cycle = append(cycle, id)
+			}
+		}
+		fail("cycle between nodes: %s", strings.Join(cycle, ", "))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return g, nil
+}
+
+// Runs the graph until all sinks are done
+// The first error (from a source, a stage or a sink) cancels the run and is returned
+func (g *Graph) Run(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	onError := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	// Channels feeding each node, keyed by the producer ID
+	inputs := make(map[string]map[string]<-chan Data[any])
+	for id := range g.nodes {
+		inputs[id] = make(map[string]<-chan Data[any])
+	}
+	connect := func(node *graphNode, outputCh <-chan Data[any]) {
+		if node.Buffer > 0 {
+			outputCh = Buffer[any](runCtx, node.Buffer)(outputCh)
+		}
+		if len(node.consumers) == 1 {
+			inputs[node.consumers[0]][node.ID] = outputCh
+			return
+		}
+		targets := make([]int, len(node.consumers))
+		for i := range targets {
+			targets[i] = i
+		}
+		branches := dispatch(outputCh, len(node.consumers), node.Buffer, func(Data[any]) []int {
+			return targets
+		})
+		for i, consumer := range node.consumers {
+			inputs[consumer][node.ID] = branches[i]
+		}
+	}
+	nodeInput := func(node *graphNode) <-chan Data[any] {
+		channels := make([]<-chan Data[any], len(node.Inputs))
+		for i, inputID := range node.Inputs {
+			channels[i] = inputs[node.ID][inputID]
+		}
+		if len(channels) == 1 {
+			return channels[0]
+		}
+		return Interleave(channels...)
+	}
+
+	var eg errgroup.Group
+	for _, id := range g.order {
+		node := g.nodes[id]
+		switch node.kind {
+		case sourceNode:
+			connect(node, g.registry.sources[node.Use].build(runCtx))
+		case stageNode:
+			stage := NamedPipe(id, g.registry.stages[node.Use].build(node.Parallelism))
+			connect(node, logStage(stage)(nodeInput(node)))
+		case sinkNode:
+			sink := g.registry.sinks[node.Use].sink
+			inputCh := intercept(nodeInput(node), onError)
+			eg.Go(func() error {
+				err := sink(inputCh)
+				if err != nil {
+					onError(err)
+				}
+				// Sink may return early: drain so the upstream nodes can finish
+				for range inputCh {
+				}
+				return err
+			})
+		}
+	}
+	eg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (g *Graph) String() string {
+	lines := []string{fmt.Sprintf("Graph: %s", g.name)}
+	for _, id := range g.order {
+		node := g.nodes[id]
+		line := fmt.Sprintf("  %-6s %-10s", node.kind, id)
+		if len(node.Inputs) > 0 {
+			line += fmt.Sprintf(" <- %s", strings.Join(node.Inputs, ", "))
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Removes errored items from the channel, reporting them to onError
+func intercept[T any](inputCh <-chan Data[T], onError func(error)) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		for data := range inputCh {
+			if data.err != nil {
+				onError(data.err)
+				continue
+			}
+			outputCh <- data
+		}
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+func toAny[T any](inputCh <-chan Data[T]) <-chan Data[any] {
+	outputCh := make(chan Data[any])
+	go func() {
+		for data := range inputCh {
+			outputCh <- Data[any]{data.index, data.item, data.err}
+		}
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+// Types were checked when the graph was validated;
+// errored items may hold a nil item, so the assertion is not forced
+func fromAny[T any](inputCh <-chan Data[any]) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		for data := range inputCh {
+			item, _ := data.item.(T)
+			outputCh <- Data[T]{data.index, item, data.err}
+		}
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+func TestGraph() {
+	ctx := context.Background()
+
+	r := NewRegistry()
+	RegisterSource(r, "numbers", func(ctx context.Context) <-chan Data[int] {
+		return FromSeq(ctx, slices.Values([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+	})
+	RegisterTransform(r, "square", square)
+	RegisterTransform(r, "double", double)
+	RegisterTransform(r, "increment", increment)
+	RegisterTransform(r, "format", func(x int) string {
+		return fmt.Sprintf("<%d>", x)
+	})
+	RegisterPipe(r, "evens", Filter(func(x int) bool {
+		return x%2 == 0
+	}))
+	RegisterSink(r, "print", func(outputCh <-chan Data[string]) error {
+		fmt.Println(Collect(outputCh))
+		return nil
+	})
+	RegisterSink(r, "sum", func(outputCh <-chan Data[int]) error {
+		total := 0
+		ForEach(outputCh, func(_ int, x int) {
+			total += x
+		})
+		fmt.Println("Sum:", total)
+		return nil
+	})
+
+	dir, err := os.MkdirTemp("", "pipeline")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	runGraph := func(filename string, content string) {
+		path := filepath.Join(dir, filename)
+		os.WriteFile(path, []byte(content), 0o644)
+		g, err := LoadGraph(r, path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println(g)
+		err = g.Run(ctx)
+		fmt.Println("Error:", err)
+	}
+
+	run(func() {
+		fmt.Println("JSON Graph")
+		runGraph("linear.json", `{
+			"name": "linear",
+			"sources": [{"id": "numbers"}],
+			"stages": [
+				{"id": "evens", "inputs": ["numbers"]},
+				{"id": "square", "inputs": ["evens"], "parallelism": 4, "buffer": 4},
+				{"id": "format", "inputs": ["square"]}
+			],
+			"sinks": [{"id": "print", "inputs": ["format"]}]
+		}`)
+	})
+
+	run(func() {
+		fmt.Println("YAML Graph (branching)")
+		runGraph("branching.yaml", `
+name: branching
+sources:
+  - id: numbers
+stages:
+  - id: square
+    inputs: [numbers]
+    parallelism: 2
+  - id: double
+    inputs: [square]
+  - id: increment
+    inputs: [square]
+  - id: format
+    inputs: [double, increment]
+sinks:
+  - id: print
+    inputs: [format]
+  - id: total
+    use: sum
+    inputs: [square]
+`)
+	})
+
+	run(func() {
+		fmt.Println("Invalid Graph")
+		runGraph("invalid.yaml", `
+name: invalid
+sources:
+  - id: numbers
+stages:
+  - id: cube
+    inputs: [numbers]
+  - id: evens
+    inputs: [numbers]
+    parallelism: 2
+  - id: a
+    use: double
+    inputs: [b]
+  - id: b
+    use: increment
+    inputs: [a]
+sinks:
+  - id: total
+    use: sum
+    inputs: [format]
+  - id: print
+    inputs: [evens]
+`)
+	})
+}
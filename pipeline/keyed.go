@@ -0,0 +1,336 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+type number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// Folds the items of one key into an accumulator
+// first creates the accumulator from the key's first item, add folds in the rest
+type Aggregator[T any, A any] struct {
+	first func(T) A
+	add   func(A, T) A
+}
+
+// Running aggregate of one key
+type Aggregate[K comparable, A any] struct {
+	Key   K   `json:"key"`
+	Value A   `json:"value"`
+	Count int `json:"count"`
+}
+
+// Aggregates of one window, in the order the keys first appeared
+type WindowAggregate[K comparable, A any] struct {
+	Start      time.Time
+	End        time.Time
+	Late       bool
+	Aggregates []Aggregate[K, A]
+}
+
+// Number of items per key
+func Count[T any]() Aggregator[T, int] {
+	return Aggregator[T, int]{
+		first: func(T) int { return 1 },
+		add:   func(count int, _ T) int { return count + 1 },
+	}
+}
+
+// Sum of the values per key
+func Sum[T any, N number](value func(T) N) Aggregator[T, N] {
+	return Aggregator[T, N]{
+		first: value,
+		add:   func(sum N, item T) N { return sum + value(item) },
+	}
+}
+
+// Minimum value per key
+func Min[T any, N cmp.Ordered](value func(T) N) Aggregator[T, N] {
+	return Aggregator[T, N]{
+		first: value,
+		add:   func(result N, item T) N { return min(result, value(item)) },
+	}
+}
+
+// Maximum value per key
+func Max[T any, N cmp.Ordered](value func(T) N) Aggregator[T, N] {
+	return Aggregator[T, N]{
+		first: value,
+		add:   func(result N, item T) N { return max(result, value(item)) },
+	}
+}
+
+// Custom reducer per key, starting from the initial value
+func Reducer[T any, A any](initial A, fn func(A, T) A) Aggregator[T, A] {
+	return Aggregator[T, A]{
+		first: func(item T) A { return fn(initial, item) },
+		add:   fn,
+	}
+}
+
+// Per-key aggregates, shared with the KeyBy stage
+// Remembers which input indices have been applied, so a restored state skips the items
+// it already covers when the pipeline is re-run with the same source
+// Indices may arrive out of order (e.g. after ParallelPipe), so like Checkpoint,
+// it keeps a contiguous watermark and the applied indices after a gap
+type KeyedState[K comparable, A any] struct {
+	mu      sync.Mutex
+	keys    []K // in the order they first appeared
+	values  map[K]*Aggregate[K, A]
+	next    int          // all indices before next have been applied
+	applied map[int]bool // applied indices after a gap
+}
+
+type keyedStateFile[K comparable, A any] struct {
+	Next       int               `json:"next"`
+	Applied    []int             `json:"applied"`
+	Aggregates []Aggregate[K, A] `json:"aggregates"`
+}
+
+func NewKeyedState[K comparable, A any]() *KeyedState[K, A] {
+	return &KeyedState[K, A]{
+		keys:    make([]K, 0),
+		values:  make(map[K]*Aggregate[K, A]),
+		applied: make(map[int]bool),
+	}
+}
+
+// Loads the snapshot from the file, or starts fresh if the file does not exist
+func LoadKeyedState[K comparable, A any](path string) (*KeyedState[K, A], error) {
+	s := NewKeyedState[K, A]()
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved keyedStateFile[K, A]
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return nil, fmt.Errorf("invalid keyed state %s: %w", path, err)
+	}
+	s.next = saved.Next
+	for _, index := range saved.Applied {
+		s.applied[index] = true
+	}
+	for _, aggregate := range saved.Aggregates {
+		s.keys = append(s.keys, aggregate.Key)
+		s.values[aggregate.Key] = &aggregate
+	}
+	return s, nil
+}
+
+// Persists a snapshot of the aggregates to the file (atomic rename)
+func (s *KeyedState[K, A]) Save(path string) error {
+	s.mu.Lock()
+	applied := make([]int, 0, len(s.applied))
+	for index := range s.applied {
+		applied = append(applied, index)
+	}
+	slices.Sort(applied)
+	snapshot := keyedStateFile[K, A]{s.next, applied, s.all()}
+	s.mu.Unlock()
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = atomicWrite(path, func(w io.Writer) (int, error) {
+		return w.Write(content)
+	})
+	return err
+}
+
+// Aggregate of the key
+func (s *KeyedState[K, A]) Get(key K) (Aggregate[K, A], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	aggregate, ok := s.values[key]
+	if !ok {
+		return Aggregate[K, A]{}, false
+	}
+	return *aggregate, true
+}
+
+// All aggregates, in the order the keys first appeared
+func (s *KeyedState[K, A]) All() []Aggregate[K, A] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.all()
+}
+
+func (s *KeyedState[K, A]) all() []Aggregate[K, A] {
+	aggregates := make([]Aggregate[K, A], len(s.keys))
+	for i, key := range s.keys {
+		aggregates[i] = *s.values[key]
+	}
+	return aggregates
+}
+
+// Marks the index as applied, returns false if it already was
+// Caller must hold the lock
+func (s *KeyedState[K, A]) markApplied(index int) bool {
+	if index < s.next || s.applied[index] {
+		return false
+	}
+	s.applied[index] = true
+	for s.applied[s.next] {
+		delete(s.applied, s.next)
+		s.next += 1
+	}
+	return true
+}
+
+// Folds the item into its key's aggregate, returns the updated aggregate
+// Caller must hold the lock
+func fold[T any, K comparable, A any](s *KeyedState[K, A], key K, item T, agg Aggregator[T, A]) Aggregate[K, A] {
+	aggregate, ok := s.values[key]
+	if ok {
+		aggregate.Value = agg.add(aggregate.Value, item)
+		aggregate.Count += 1
+	} else {
+		aggregate = &Aggregate[K, A]{key, agg.first(item), 1}
+		s.keys = append(s.keys, key)
+		s.values[key] = aggregate
+	}
+	return *aggregate
+}
+
+// Groups items by key, and emits the key's updated aggregate on each item (index preserved)
+// Items whose index the state has already applied are skipped (e.g. after a restore)
+func KeyBy[T any, K comparable, A any](state *KeyedState[K, A], key func(T) K, agg Aggregator[T, A]) PipeFn[T, Aggregate[K, A]] {
+	return func(inputCh <-chan Data[T]) <-chan Data[Aggregate[K, A]] {
+		outputCh := make(chan Data[Aggregate[K, A]])
+		go func() {
+			for input := range inputCh {
+				if passError(input, outputCh) {
+					continue
+				}
+				state.mu.Lock()
+				if !state.markApplied(input.index) {
+					state.mu.Unlock()
+					continue
+				}
+				aggregate := fold(state, key(input.item), input.item, agg)
+				state.mu.Unlock()
+				outputCh <- Data[Aggregate[K, A]]{input.index, aggregate, nil}
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Groups the items of each window by key, and emits the aggregates when the window closes
+// Use after a WindowFn; each window (and late update) starts from fresh state
+func KeyByWindow[T any, K comparable, A any](key func(T) K, agg Aggregator[T, A]) PipeFn[Window[T], WindowAggregate[K, A]] {
+	return Pipe(func(w Window[T]) WindowAggregate[K, A] {
+		state := NewKeyedState[K, A]()
+		for _, item := range w.Items {
+			fold(state, key(item), item, agg)
+		}
+		return WindowAggregate[K, A]{w.Start, w.End, w.Late, state.all()}
+	})
+}
+
+type sale struct {
+	Store  string
+	Amount int
+	At     time.Time
+}
+
+func TestKeyed() {
+	start := time.Date(2025, 10, 27, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+	sales := []sale{
+		{"north", 10, at(1)}, {"south", 25, at(2)}, {"north", 5, at(4)},
+		{"east", 40, at(6)}, {"south", 15, at(7)}, {"north", 30, at(9)},
+		{"east", 20, at(11)}, {"north", 15, at(12)},
+	}
+	store := func(s sale) string {
+		return s.Store
+	}
+	amount := func(s sale) int {
+		return s.Amount
+	}
+
+	run(func() {
+		fmt.Println("Running Count, Min, Max")
+		for _, a := range Collect(KeyBy(NewKeyedState[string, int](), store, Count[sale]())(Generate(sales...))) {
+			fmt.Printf("%s: %d\n", a.Key, a.Value)
+		}
+		maxState := NewKeyedState[string, int]()
+		minState := NewKeyedState[string, int]()
+		drain(KeyBy(maxState, store, Max(amount))(Generate(sales...)))
+		drain(KeyBy(minState, store, Min(amount))(Generate(sales...)))
+		fmt.Println("Max:", maxState.All())
+		fmt.Println("Min:", minState.All())
+	})
+
+	run(func() {
+		fmt.Println("Custom Reducer (amounts per store)")
+		state := NewKeyedState[string, []int]()
+		drain(KeyBy(state, store, Reducer(nil, func(amounts []int, s sale) []int {
+			return append(amounts, s.Amount)
+		}))(Generate(sales...)))
+		for _, a := range state.All() {
+			fmt.Printf("%s: %v\n", a.Key, a.Value)
+		}
+	})
+
+	run(func() {
+		fmt.Println("Window Close (sum per store, tumbling 5s)")
+		windows, lateCh := TumblingWindow(5*time.Second, func(s sale) time.Time {
+			return s.At
+		})(Generate(sales...))
+		go drain(lateCh)
+		for _, w := range Collect(KeyByWindow(store, Sum(amount))(windows)) {
+			fmt.Printf("[%s, %s) %v\n", w.Start.Format("15:04:05"), w.End.Format("15:04:05"), w.Aggregates)
+		}
+	})
+
+	run(func() {
+		fmt.Println("Snapshot and Resume (sum per store)")
+		dir, err := os.MkdirTemp("", "pipeline")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "sales.state")
+
+		// First run only gets the first half, then snapshots
+		state := NewKeyedState[string, int]()
+		drain(KeyBy(state, store, Sum(amount))(Generate(sales[:4]...)))
+		if err := state.Save(path); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Saved:", state.All())
+
+		// Restarted run replays the whole source; the first half is skipped
+		state, err = LoadKeyedState[string, int](path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		ForEach(KeyBy(state, store, Sum(amount))(Generate(sales...)), func(i int, a Aggregate[string, int]) {
+			fmt.Printf("%d: %s = %d\n", i, a.Key, a.Value)
+		})
+		fmt.Println("Resumed:", state.All())
+	})
+}
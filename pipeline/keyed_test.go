@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyByOutOfOrder(t *testing.T) {
+	data := make([]int, 200)
+	for i := range data {
+		data[i] = i
+	}
+	identity := func(x int) int {
+		return x
+	}
+	parity := func(x int) string {
+		if x%2 == 0 {
+			return "even"
+		}
+		return "odd"
+	}
+	checkCounts := func(state *KeyedState[string, int]) {
+		t.Helper()
+		for _, key := range []string{"even", "odd"} {
+			if a, _ := state.Get(key); a.Value != 100 {
+				t.Errorf("%s: got count %d, want 100", key, a.Value)
+			}
+		}
+	}
+
+	state := NewKeyedState[string, int]()
+	drain(KeyBy(state, parity, Count[int]())(ParallelPipe(identity, 4)(Generate(data...))))
+	checkCounts(state)
+
+	// Snapshot mid-stream, then resume from it over the same source
+	path := filepath.Join(t.TempDir(), "counts.state")
+	state = NewKeyedState[string, int]()
+	count := 0
+	ForEach(KeyBy(state, parity, Count[int]())(ParallelPipe(identity, 4)(Generate(data...))), func(int, Aggregate[string, int]) {
+		count += 1
+		if count == 73 {
+			if err := state.Save(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	restored, err := LoadKeyedState[string, int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drain(KeyBy(restored, parity, Count[int]())(ParallelPipe(identity, 4)(Generate(data...))))
+	checkCounts(restored)
+}
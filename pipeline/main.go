@@ -8,7 +8,22 @@ import (
 )
 
 func main() {
-	TestPipeline()
+	// TestPipeline()
+	// TestSinks()
+	// TestBuilder()
+	// TestOperators()
+	// TestBranch()
+	// TestMetrics()
+	// TestSources()
+	// TestWriters()
+	// TestCheckpoint()
+	// TestWindows()
+	// TestFlow()
+	// TestGraph()
+	// TestWatchdog()
+	// TestKeyed()
+	// TestSeq()
+	TestRemote()
 }
 
 func run(task func()) {
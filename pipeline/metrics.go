@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Upper bounds of the latency histogram buckets (last bucket is unbounded)
+var latencyBounds = []time.Duration{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	5 * time.Second,
+}
+
+// Collects per-stage metrics, in the order the stages were registered
+type Metrics struct {
+	mu     sync.Mutex
+	stages []*StageStats
+}
+
+type StageStats struct {
+	mu       sync.Mutex
+	name     string
+	itemsIn  int
+	itemsOut int
+	recvWait time.Duration // time blocked waiting for upstream
+	sendWait time.Duration // time blocked waiting for downstream
+	capacity int           // output buffer size
+	queueSum int
+	queueMax int
+	samples  int
+	latency  []int // histogram counts, one per bucket
+	total    time.Duration
+	maxTime  time.Duration
+	measured int
+	timed    bool              // latency is recorded (index-preserving stage)
+	inFlight map[int]time.Time // index => time handed to the stage
+}
+
+type StageSnapshot struct {
+	Name        string
+	ItemsIn     int
+	ItemsOut    int
+	RecvWait    time.Duration
+	SendWait    time.Duration
+	MeanLatency time.Duration
+	P95Latency  time.Duration
+	MaxLatency  time.Duration
+	Timed       bool // latency is recorded
+	Histogram   []int
+	AvgQueue    float64
+	MaxQueue    int
+	Capacity    int
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{stages: make([]*StageStats, 0)}
+}
+
+// Gets the stats of the named stage, creating it if it does not exist yet
+func (m *Metrics) Stage(name string) *StageStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stats := range m.stages {
+		if stats.name == name {
+			return stats
+		}
+	}
+	stats := &StageStats{
+		name:     name,
+		latency:  make([]int, len(latencyBounds)+1),
+		inFlight: make(map[int]time.Time),
+	}
+	m.stages = append(m.stages, stats)
+	return stats
+}
+
+// Wraps the index-preserving pipe with relays that record the stage metrics
+// Processing latency is measured from handing an item to the stage until an
+// output with the same index comes out; use InstrumentRenumbered for stages that renumber
+// The output is buffered with bufferSize, to be able to observe the queue depth
+func Instrument[X any, Y any](m *Metrics, name string, bufferSize int, pipe PipeFn[X, Y]) PipeFn[X, Y] {
+	return instrument(m, name, bufferSize, true, pipe)
+}
+
+// Like Instrument, but for stages that renumber their output (e.g. Filter, Batch, Take),
+// whose output index does not match an input: latency is not recorded
+func InstrumentRenumbered[X any, Y any](m *Metrics, name string, bufferSize int, pipe PipeFn[X, Y]) PipeFn[X, Y] {
+	return instrument(m, name, bufferSize, false, pipe)
+}
+
+func instrument[X any, Y any](m *Metrics, name string, bufferSize int, timed bool, pipe PipeFn[X, Y]) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		stats := m.Stage(name)
+		stats.setup(bufferSize, timed)
+
+		stageCh := make(chan Data[X])
+		go func() {
+			for {
+				start := time.Now()
+				input, ok := <-inputCh
+				stats.addRecvWait(time.Since(start))
+				if !ok {
+					break
+				}
+				// Recorded before the send, since a fast stage may emit the output right away
+				stats.itemIn(input.index)
+				stageCh <- input
+			}
+			close(stageCh)
+		}()
+
+		outputCh := make(chan Data[Y], bufferSize)
+		go func() {
+			for output := range pipe(stageCh) {
+				stats.itemOut(output.index)
+				start := time.Now()
+				outputCh <- output
+				stats.addSendWait(time.Since(start), len(outputCh))
+			}
+			stats.clearInFlight()
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Returns a copy of the index-preserving stage that records its metrics
+func (s Stage[X, Y]) Observe(m *Metrics, bufferSize int) Stage[X, Y] {
+	return Stage[X, Y]{s.name, Instrument(m, s.name, bufferSize, s.pipe)}
+}
+
+// Returns a copy of the renumbering stage that records its metrics, except latency
+func (s Stage[X, Y]) ObserveRenumbered(m *Metrics, bufferSize int) Stage[X, Y] {
+	return Stage[X, Y]{s.name, InstrumentRenumbered(m, s.name, bufferSize, s.pipe)}
+}
+
+func (m *Metrics) Snapshot() []StageSnapshot {
+	m.mu.Lock()
+	stages := append([]*StageStats{}, m.stages...)
+	m.mu.Unlock()
+
+	snapshots := make([]StageSnapshot, len(stages))
+	for i, stats := range stages {
+		snapshots[i] = stats.snapshot()
+	}
+	return snapshots
+}
+
+// Text report of all stages, flagging the slowest one (highest mean latency)
+func (m *Metrics) Report() string {
+	snapshots := m.Snapshot()
+	slowest := -1
+	for i, snap := range snapshots {
+		if snap.MeanLatency > 0 && (slowest < 0 || snap.MeanLatency > snapshots[slowest].MeanLatency) {
+			slowest = i
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-12s %6s %6s %10s %10s %10s %10s %10s %8s\n",
+		"Stage", "In", "Out", "RecvWait", "SendWait", "Mean", "P95", "Max", "Queue"))
+	for i, snap := range snapshots {
+		flag := ""
+		if i == slowest {
+			flag = "  <= slowest"
+		}
+		queue := fmt.Sprintf("%.1f/%d", snap.AvgQueue, snap.Capacity)
+		mean, p95, maxLatency := "-", "-", "-"
+		if snap.Timed {
+			mean = snap.MeanLatency.Round(time.Millisecond).String()
+			p95 = snap.P95Latency.String()
+			maxLatency = snap.MaxLatency.Round(time.Millisecond).String()
+		}
+		sb.WriteString(fmt.Sprintf("%-12s %6d %6d %10v %10v %10s %10s %10s %8s%s\n",
+			snap.Name, snap.ItemsIn, snap.ItemsOut,
+			snap.RecvWait.Round(time.Millisecond), snap.SendWait.Round(time.Millisecond),
+			mean, p95, maxLatency, queue, flag))
+	}
+	return sb.String()
+}
+
+// Periodically writes the report to w, until the context is cancelled
+func (m *Metrics) Monitor(ctx context.Context, interval time.Duration, w io.Writer) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fmt.Fprintln(w, m.Report())
+			}
+		}
+	}()
+}
+
+func (s *StageStats) setup(capacity int, timed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity = capacity
+	s.timed = timed
+}
+
+func (s *StageStats) addRecvWait(duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recvWait += duration
+}
+
+func (s *StageStats) addSendWait(duration time.Duration, queueLength int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendWait += duration
+	s.queueSum += queueLength
+	s.queueMax = max(s.queueMax, queueLength)
+	s.samples += 1
+}
+
+func (s *StageStats) itemIn(index int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.itemsIn += 1
+	if s.timed {
+		s.inFlight[index] = time.Now()
+	}
+}
+
+func (s *StageStats) itemOut(index int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.itemsOut += 1
+	start, ok := s.inFlight[index]
+	if !ok {
+		return
+	}
+	delete(s.inFlight, index)
+	duration := time.Since(start)
+	s.latency[bucketOf(duration)] += 1
+	s.total += duration
+	s.maxTime = max(s.maxTime, duration)
+	s.measured += 1
+}
+
+func (s *StageStats) clearInFlight() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.inFlight)
+}
+
+func (s *StageStats) snapshot() StageSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := StageSnapshot{
+		Name:       s.name,
+		ItemsIn:    s.itemsIn,
+		ItemsOut:   s.itemsOut,
+		RecvWait:   s.recvWait,
+		SendWait:   s.sendWait,
+		MaxLatency: s.maxTime,
+		Timed:      s.timed,
+		Histogram:  append([]int{}, s.latency...),
+		MaxQueue:   s.queueMax,
+		Capacity:   s.capacity,
+	}
+	if s.measured > 0 {
+		snap.MeanLatency = s.total / time.Duration(s.measured)
+		snap.P95Latency = percentile(s.latency, s.measured, 0.95)
+	}
+	if s.samples > 0 {
+		snap.AvgQueue = float64(s.queueSum) / float64(s.samples)
+	}
+	return snap
+}
+
+func bucketOf(duration time.Duration) int {
+	for i, bound := range latencyBounds {
+		if duration <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// Estimates the percentile as the upper bound of the bucket that contains it
+func percentile(histogram []int, total int, p float64) time.Duration {
+	target := int(float64(total)*p + 0.5)
+	count := 0
+	for i, bucketCount := range histogram {
+		count += bucketCount
+		if count >= target && i < len(latencyBounds) {
+			return latencyBounds[i]
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+func TestMetrics() {
+	data := list.NumRange(1, 11)
+
+	run(func() {
+		fmt.Println("Pipeline Metrics")
+		m := NewMetrics()
+		slowSquare := func(x int) int {
+			time.Sleep(2 * delay)
+			return square(x)
+		}
+		p := NewPipeline(NewStage("square", slowSquare).Observe(m, 0)).
+			Then(NamedPipe("even", Filter(func(x int) bool { return x%2 == 0 })).ObserveRenumbered(m, 2)).
+			Then(NewStage("double", double).Observe(m, 2)).
+			Then(NewStage("increment", increment).Observe(m, 2))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		m.Monitor(ctx, time.Second, os.Stdout)
+
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			fmt.Println(Collect(outputCh))
+			return nil
+		})
+		cancel()
+		fmt.Println("Error:", err)
+		fmt.Println(m.Report())
+	})
+}
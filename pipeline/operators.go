@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Index semantics of the operators:
+//   - Scan preserves the index (one output per input)
+//   - Filter, FlatMap, Distinct, Take, Skip and Batch renumber their output
+//     densely (0, 1, 2, ...) in arrival order, so Consume/Collect/Stream stay correct
+//   - Arrival order is not index order after a reordering stage (e.g. ParallelPipe):
+//     there, Take(n) keeps the first n items to arrive, not the first n by index;
+//     restore the order first (e.g. Stream) if it matters
+//   - Reduce and Fold emit a single item, numbered after the forwarded errors
+//   - Errored items are forwarded untransformed and not counted; stages that renumber
+//     their output give errors the next index of the same sequence, so indices never collide
+
+// Keeps only the items that pass the predicate
+func Filter[T any](keep func(T) bool) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			index := 0
+			for input := range inputCh {
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				if !keep(input.item) {
+					continue
+				}
+				outputCh <- Data[T]{index, input.item, nil}
+				index += 1
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Maps each item to zero or more items
+func FlatMap[X any, Y any](fn func(X) []Y) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		outputCh := make(chan Data[Y])
+		go func() {
+			index := 0
+			for input := range inputCh {
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				for _, item := range fn(input.item) {
+					outputCh <- Data[Y]{index, item, nil}
+					index += 1
+				}
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Combines all items into one, using the first item as the initial value
+// Emits nothing if the input is empty
+func Reduce[T any](fn func(T, T) T) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			var result T
+			count, index := 0, 0
+			for input := range inputCh {
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				if count == 0 {
+					result = input.item
+				} else {
+					result = fn(result, input.item)
+				}
+				count += 1
+			}
+			if count > 0 {
+				outputCh <- Data[T]{index, result, nil}
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Combines all items into one, starting from the initial value
+// Always emits exactly one item
+func Fold[X any, Y any](initial Y, fn func(Y, X) Y) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		outputCh := make(chan Data[Y])
+		go func() {
+			result := initial
+			index := 0
+			for input := range inputCh {
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				result = fn(result, input.item)
+			}
+			outputCh <- Data[Y]{index, result, nil}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Emits running aggregates: the accumulated value after each item
+func Scan[X any, Y any](initial Y, fn func(Y, X) Y) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		outputCh := make(chan Data[Y])
+		go func() {
+			result := initial
+			for input := range inputCh {
+				if passError(input, outputCh) {
+					continue
+				}
+				result = fn(result, input.item)
+				outputCh <- Data[Y]{input.index, result, nil}
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Groups items into batches of size n
+// A partial batch is emitted if maxWait has passed since its first item (if maxWait > 0),
+// or when the input closes
+// Panics if n is less than 1
+func Batch[T any](n int, maxWait time.Duration) PipeFn[T, []T] {
+	if n < 1 {
+		panic(fmt.Sprintf("Batch: size %d must be at least 1", n))
+	}
+	return func(inputCh <-chan Data[T]) <-chan Data[[]T] {
+		outputCh := make(chan Data[[]T])
+		go func() {
+			index := 0
+			batch := make([]T, 0, n)
+			var timeout <-chan time.Time
+
+			flush := func() {
+				if len(batch) > 0 {
+					outputCh <- Data[[]T]{index, batch, nil}
+					index += 1
+					batch = make([]T, 0, n)
+				}
+				timeout = nil
+			}
+
+			for {
+				select {
+				case input, ok := <-inputCh:
+					if !ok {
+						flush()
+						close(outputCh)
+						return
+					}
+					if passErrorAt(input, outputCh, &index) {
+						continue
+					}
+					if len(batch) == 0 && maxWait > 0 {
+						timeout = time.After(maxWait)
+					}
+					batch = append(batch, input.item)
+					if len(batch) >= n {
+						flush()
+					}
+				case <-timeout:
+					flush()
+				}
+			}
+		}()
+		return outputCh
+	}
+}
+
+// Drops items that have been seen before
+func Distinct[T comparable]() PipeFn[T, T] {
+	return DistinctBy(func(item T) T {
+		return item
+	})
+}
+
+// Drops items whose key has been seen before
+func DistinctBy[T any, K comparable](key func(T) K) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			index := 0
+			seen := make(map[K]bool)
+			for input := range inputCh {
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				k := key(input.item)
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+				outputCh <- Data[T]{index, input.item, nil}
+				index += 1
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Keeps only the first n items (in arrival order); errored items are forwarded and not counted
+// The rest of the input is drained (not forwarded), so upstream stages can finish
+func Take[T any](n int) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			defer drain(inputCh)
+			defer close(outputCh)
+			count, index := 0, 0
+			for count < n {
+				input, ok := <-inputCh
+				if !ok {
+					return
+				}
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				outputCh <- Data[T]{index, input.item, nil}
+				count += 1
+				index += 1
+			}
+		}()
+		return outputCh
+	}
+}
+
+// Drops the first n items
+func Skip[T any](n int) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			count, index := 0, 0
+			for input := range inputCh {
+				if passErrorAt(input, outputCh, &index) {
+					continue
+				}
+				count += 1
+				if count <= n {
+					continue
+				}
+				outputCh <- Data[T]{index, input.item, nil}
+				index += 1
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+func TestOperators() {
+	data := list.NumRange(1, 21)
+
+	run(func() {
+		fmt.Println("Filter, FlatMap, Distinct")
+		isEven := Filter(func(x int) bool { return x%2 == 0 })
+		repeat := FlatMap(func(x int) []int { return []int{x / 4, x / 4} })
+		out := Collect(Distinct[int]()(repeat(isEven(Generate(data...)))))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Skip, Take")
+		out := Collect(Take[int](5)(Skip[int](3)(Generate(data...))))
+		fmt.Println(out)
+		fmt.Println("Take(0):", Collect(Take[int](0)(Generate(data...))))
+	})
+
+	run(func() {
+		fmt.Println("Reduce, Fold, Scan")
+		sum := func(a, b int) int { return a + b }
+		fmt.Println("Reduce:", Collect(Reduce(sum)(Generate(data...))))
+		fmt.Println("Fold:", Collect(Fold("", func(text string, x int) string {
+			return text + fmt.Sprint(x%10)
+		})(Generate(data...))))
+		fmt.Println("Scan:", Collect(Scan(0, sum)(Generate(data...))))
+	})
+
+	run(func() {
+		fmt.Println("Batch")
+		in := Generate(list.NumRange(1, 8)...)
+		for batch := range Stream(Batch[int](3, 150*time.Millisecond)(Pipe(square)(in))) {
+			fmt.Println("Batch:", batch)
+		}
+	})
+}
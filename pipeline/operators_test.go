@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errBad = errors.New("bad item")
+
+func sourceOf[T any](items ...Data[T]) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		for _, item := range items {
+			outputCh <- item
+		}
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+// Checks that no two outputs share an index, and that the error got through
+func checkIndexes[T any](t *testing.T, name string, outputCh <-chan Data[T]) {
+	t.Helper()
+	seen := make(map[int]bool)
+	errs := 0
+	for data := range outputCh {
+		if seen[data.index] {
+			t.Errorf("%s: index %d emitted twice", name, data.index)
+		}
+		seen[data.index] = true
+		if data.err != nil {
+			errs += 1
+		}
+	}
+	if errs != 1 {
+		t.Errorf("%s: got %d errors, want 1", name, errs)
+	}
+}
+
+func TestRenumberedErrorIndexes(t *testing.T) {
+	input := func() <-chan Data[int] {
+		return sourceOf(Data[int]{0, 0, errBad}, Data[int]{1, 10, nil}, Data[int]{2, 20, nil})
+	}
+	keepAll := func(int) bool { return true }
+	sum := func(a, b int) int { return a + b }
+
+	pipes := map[string]PipeFn[int, int]{
+		"Filter":   Filter(keepAll),
+		"FlatMap":  FlatMap(func(x int) []int { return []int{x} }),
+		"Distinct": Distinct[int](),
+		"Take":     Take[int](5),
+		"Skip":     Skip[int](1),
+		"Reduce":   Reduce(sum),
+		"Fold":     Fold(0, sum),
+	}
+	for name, pipe := range pipes {
+		checkIndexes(t, name, pipe(input()))
+	}
+	checkIndexes(t, "Batch", Batch[int](1, 0)(input()))
+
+	// Forwarded errors do not use up Take's n
+	items := 0
+	for data := range Take[int](2)(input()) {
+		if data.err == nil {
+			items += 1
+		}
+	}
+	if items != 2 {
+		t.Errorf("Take(2): got %d items, want 2", items)
+	}
+
+	ctx := context.Background()
+	checkIndexes(t, "Debounce", Debounce[int](ctx, time.Millisecond)(input()))
+	checkIndexes(t, "Sample", Sample[int](ctx, time.Millisecond)(input()))
+
+	windows, lateCh := TumblingWindow(time.Second, func(x int) time.Time {
+		return time.Unix(int64(x), 0)
+	})(input())
+	go drain(lateCh)
+	checkIndexes(t, "TumblingWindow", windows)
+}
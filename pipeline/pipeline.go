@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/roidaradal/fn"
@@ -11,6 +13,7 @@ import (
 type Data[T any] struct {
 	index int
 	item  T
+	err   error
 }
 
 type TransformFn[X any, Y any] = func(X) Y
@@ -43,7 +46,7 @@ func Generate[T any](items ...T) <-chan Data[T] {
 	outputCh := make(chan Data[T])
 	go func() {
 		for i, item := range items {
-			outputCh <- Data[T]{i, item}
+			outputCh <- Data[T]{i, item, nil}
 		}
 		close(outputCh)
 	}()
@@ -53,6 +56,9 @@ func Generate[T any](items ...T) <-chan Data[T] {
 func Consume[T any](channel <-chan Data[T], size int) []T {
 	output := make([]T, size)
 	for data := range channel {
+		if data.err != nil {
+			continue
+		}
 		output[data.index] = data.item
 	}
 	return output
@@ -63,7 +69,10 @@ func Pipe[X any, Y any](fn TransformFn[X, Y]) PipeFn[X, Y] {
 		outputCh := make(chan Data[Y])
 		go func() {
 			for input := range inputCh {
-				outputCh <- Data[Y]{input.index, fn(input.item)}
+				if passError(input, outputCh) {
+					continue
+				}
+				outputCh <- Data[Y]{input.index, fn(input.item), nil}
 			}
 			close(outputCh)
 		}()
@@ -71,6 +80,207 @@ func Pipe[X any, Y any](fn TransformFn[X, Y]) PipeFn[X, Y] {
 	}
 }
 
+// Runs fn on numWorkers goroutines
+// Preserves the index, but not the arrival order (use Stream or Collect to restore it)
+func ParallelPipe[X any, Y any](fn TransformFn[X, Y], numWorkers int) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		outputCh := make(chan Data[Y])
+		var wg sync.WaitGroup
+		for range numWorkers {
+			wg.Go(func() {
+				for input := range inputCh {
+					if passError(input, outputCh) {
+						continue
+					}
+					outputCh <- Data[Y]{input.index, fn(input.item), nil}
+				}
+			})
+		}
+		go func() {
+			wg.Wait()
+			close(outputCh)
+		}()
+		return outputCh
+	}
+}
+
+// Caps the rate to at most rate items per second
+// Preserves the index; stops forwarding when the context is cancelled
+// Panics if the rate is not positive
+func Throttle[T any](ctx context.Context, rate float64) PipeFn[T, T] {
+	if !(rate > 0) {
+		panic(fmt.Sprintf("Throttle: rate %v must be positive", rate))
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			defer close(outputCh)
+			var next time.Time
+			for input := range inputCh {
+				if wait := time.Until(next); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						drain(inputCh)
+						return
+					}
+				}
+				if !emit(ctx, outputCh, input) {
+					drain(inputCh)
+					return
+				}
+				next = time.Now().Add(interval)
+			}
+		}()
+		return outputCh
+	}
+}
+
+// Emits an item only after a quiet period of d with no newer item
+// The last pending item is emitted when the input closes
+// Output is renumbered densely (0, 1, 2, ...), since items are dropped; errors share the sequence
+func Debounce[T any](ctx context.Context, d time.Duration) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			defer close(outputCh)
+			index := 0
+			var pending *Data[T]
+			var quiet <-chan time.Time
+			for {
+				select {
+				case input, ok := <-inputCh:
+					if !ok {
+						if pending != nil {
+							emit(ctx, outputCh, Data[T]{index, pending.item, nil})
+						}
+						return
+					}
+					if input.err != nil {
+						if !emit(ctx, outputCh, Data[T]{index, input.item, input.err}) {
+							drain(inputCh)
+							return
+						}
+						index += 1
+						continue
+					}
+					pending = &input
+					quiet = time.After(d)
+				case <-quiet:
+					if !emit(ctx, outputCh, Data[T]{index, pending.item, nil}) {
+						drain(inputCh)
+						return
+					}
+					index += 1
+					pending, quiet = nil, nil
+				case <-ctx.Done():
+					drain(inputCh)
+					return
+				}
+			}
+		}()
+		return outputCh
+	}
+}
+
+// Emits the latest item received in each interval of d (nothing if none arrived)
+// The last pending item is emitted when the input closes
+// Output is renumbered densely (0, 1, 2, ...), since items are dropped; errors share the sequence
+func Sample[T any](ctx context.Context, d time.Duration) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T])
+		go func() {
+			defer close(outputCh)
+			ticker := time.NewTicker(d)
+			defer ticker.Stop()
+			index := 0
+			var pending *Data[T]
+			for {
+				select {
+				case input, ok := <-inputCh:
+					if !ok {
+						if pending != nil {
+							emit(ctx, outputCh, Data[T]{index, pending.item, nil})
+						}
+						return
+					}
+					if input.err != nil {
+						if !emit(ctx, outputCh, Data[T]{index, input.item, input.err}) {
+							drain(inputCh)
+							return
+						}
+						index += 1
+						continue
+					}
+					pending = &input
+				case <-ticker.C:
+					if pending == nil {
+						continue
+					}
+					if !emit(ctx, outputCh, Data[T]{index, pending.item, nil}) {
+						drain(inputCh)
+						return
+					}
+					index += 1
+					pending = nil
+				case <-ctx.Done():
+					drain(inputCh)
+					return
+				}
+			}
+		}()
+		return outputCh
+	}
+}
+
+// Decouples a fast producer from a slow stage, with a buffer of the given size
+// Preserves the index; stops forwarding when the context is cancelled
+func Buffer[T any](ctx context.Context, size int) PipeFn[T, T] {
+	return func(inputCh <-chan Data[T]) <-chan Data[T] {
+		outputCh := make(chan Data[T], size)
+		go func() {
+			defer close(outputCh)
+			for input := range inputCh {
+				if !emit(ctx, outputCh, input) {
+					drain(inputCh)
+					return
+				}
+			}
+		}()
+		return outputCh
+	}
+}
+
+// Receives the rest of the input without forwarding, so upstream stages can finish
+func drain[T any](inputCh <-chan Data[T]) {
+	for range inputCh {
+	}
+}
+
+// Forwards an errored item downstream as-is, returns true if it was an error
+// Stages skip errored items, so the error reaches the end of the pipeline
+func passError[X any, Y any](input Data[X], outputCh chan<- Data[Y]) bool {
+	if input.err == nil {
+		return false
+	}
+	var zero Y
+	outputCh <- Data[Y]{input.index, zero, input.err}
+	return true
+}
+
+// Forwards an errored item numbered from the stage's own output sequence, and advances it
+// Used by stages that renumber their output, so errors never share an index with items
+func passErrorAt[X any, Y any](input Data[X], outputCh chan<- Data[Y], index *int) bool {
+	if input.err == nil {
+		return false
+	}
+	var zero Y
+	outputCh <- Data[Y]{*index, zero, input.err}
+	*index += 1
+	return true
+}
+
 func TestPipeline() {
 	data := list.NumRange(1, 11)
 
@@ -91,3 +301,54 @@ func TestPipeline() {
 		fmt.Println(out)
 	})
 }
+
+func TestFlow() {
+	ctx := context.Background()
+	data := list.NumRange(1, 11)
+
+	// Bursts of 3 items, with a pause after each burst
+	bursts := func() <-chan Data[int] {
+		channel := make(chan int)
+		go func() {
+			for _, x := range data {
+				channel <- x
+				if x%3 == 0 {
+					time.Sleep(3 * delay)
+				}
+			}
+			close(channel)
+		}()
+		return FromChannel(ctx, channel)
+	}
+
+	run(func() {
+		fmt.Println("Throttle (5 per second)")
+		ForEach(Throttle[int](ctx, 5)(Generate(data...)), func(index int, item int) {
+			fmt.Printf("Item %d: %d\n", index, item)
+		})
+	})
+
+	run(func() {
+		fmt.Println("Debounce (quiet for 150ms)")
+		out := Collect(Debounce[int](ctx, 150*time.Millisecond)(bursts()))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Sample (every 200ms)")
+		source := Ticker(ctx, 50*time.Millisecond, 20, func(i int) int {
+			return i + 1
+		})
+		out := Collect(Sample[int](ctx, 200*time.Millisecond)(source))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Buffer (cancelled after 350ms)")
+		bufferCtx, cancel := context.WithTimeout(ctx, 350*time.Millisecond)
+		defer cancel()
+		buffered := Buffer[int](bufferCtx, 5)(Generate(data...))
+		out := Collect(Throttle[int](bufferCtx, 10)(buffered))
+		fmt.Println(out)
+	})
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Remote stages run a PipeFn in another process (Serve), reached over a Unix socket or loopback TCP
+// Flow control is credit-based: the server grants a window of credits, the client spends one
+// per item sent and gets it back with each result, so at most window items are in flight
+// The remote PipeFn must emit exactly one output per input, with the index preserved (e.g. Pipe, ParallelPipe)
+
+// Pluggable wire format
+type Codec interface {
+	NewEncoder(io.Writer) Encoder
+	NewDecoder(io.Reader) Decoder
+}
+
+type Encoder interface {
+	Encode(any) error
+}
+
+type Decoder interface {
+	Decode(any) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (JSONCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+type GobCodec struct{}
+
+func (GobCodec) NewEncoder(w io.Writer) Encoder {
+	return gob.NewEncoder(w)
+}
+
+func (GobCodec) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
+
+type remoteRequest[X any] struct {
+	Index int
+	Item  X
+}
+
+// Result of one item, which also returns its credit
+// The first frame of a connection only carries the initial credit grant (Index -1)
+type remoteResponse[Y any] struct {
+	Index  int
+	Item   Y
+	Err    string
+	Credit int
+}
+
+// Accepts connections until the context is cancelled, and runs the pipe for each connection
+// Grants each client a window of credits (items in flight)
+func Serve[X any, Y any](ctx context.Context, listener net.Listener, codec Codec, pipe PipeFn[X, Y], window int) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	var wg sync.WaitGroup
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Go(func() {
+			serveConn(ctx, conn, codec, pipe, window)
+		})
+	}
+}
+
+func serveConn[X any, Y any](ctx context.Context, conn net.Conn, codec Codec, pipe PipeFn[X, Y], window int) {
+	// Closing the connection unblocks the reader and the writer
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-doneCh:
+		}
+		conn.Close()
+	}()
+
+	encoder := codec.NewEncoder(conn)
+	decoder := codec.NewDecoder(conn)
+	if err := encoder.Encode(remoteResponse[Y]{Index: -1, Credit: window}); err != nil {
+		return
+	}
+
+	// Buffered to the window: the client never sends more than its credits
+	inputCh := make(chan Data[X], window)
+	go func() {
+		defer close(inputCh)
+		for {
+			var request remoteRequest[X]
+			if err := decoder.Decode(&request); err != nil {
+				return // EOF: client has sent everything
+			}
+			inputCh <- Data[X]{request.Index, request.Item, nil}
+		}
+	}()
+
+	outputCh := pipe(inputCh)
+	for output := range outputCh {
+		response := remoteResponse[Y]{output.index, output.item, "", 1}
+		if output.err != nil {
+			response.Err = output.err.Error()
+		}
+		if err := encoder.Encode(response); err != nil {
+			drain(outputCh)
+			return
+		}
+	}
+}
+
+// Stage that sends the items to the server at the address ("unix" or "tcp" network),
+// and emits the results in the order the items were sent
+// Dial failure and connection loss are emitted as errored items, and the rest of the input is drained
+func Remote[X any, Y any](network string, address string, codec Codec) PipeFn[X, Y] {
+	return func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		outputCh := make(chan Data[Y])
+		go func() {
+			defer close(outputCh)
+			var zero Y
+			fail := func(index int, err error) {
+				outputCh <- Data[Y]{index, zero, fmt.Errorf("remote %s: %w", address, err)}
+				drain(inputCh)
+			}
+
+			conn, err := net.Dial(network, address)
+			if err != nil {
+				fail(0, err)
+				return
+			}
+			defer conn.Close()
+			encoder := codec.NewEncoder(conn)
+			decoder := codec.NewDecoder(conn)
+
+			var grant remoteResponse[Y]
+			if err := decoder.Decode(&grant); err != nil {
+				fail(0, err)
+				return
+			}
+			creditCh := make(chan struct{}, grant.Credit)
+			for range grant.Credit {
+				creditCh <- struct{}{}
+			}
+
+			// Connection is broken once, by the sender or the receiver
+			var brokenErr error
+			brokenCh := make(chan struct{})
+			var once sync.Once
+			broken := func(err error) {
+				once.Do(func() {
+					brokenErr = err
+					close(brokenCh)
+				})
+			}
+			doneCh := make(chan struct{})
+			defer close(doneCh)
+
+			// Sender: spends a credit per item, and records the order items were sent in
+			orderCh := make(chan Data[X], grant.Credit)
+			go func() {
+				defer close(orderCh)
+				for input := range inputCh {
+					if input.err == nil {
+						select {
+						case <-creditCh:
+						case <-brokenCh:
+							drain(inputCh)
+							return
+						}
+						if err := encoder.Encode(remoteRequest[X]{input.index, input.item}); err != nil {
+							broken(err)
+							drain(inputCh)
+							return
+						}
+					}
+					orderCh <- input
+				}
+				// Tell the server there is no more input
+				if c, ok := conn.(interface{ CloseWrite() error }); ok {
+					c.CloseWrite()
+				}
+			}()
+
+			// Receiver: returns the credit of each result
+			resultCh := make(chan Data[Y])
+			go func() {
+				for {
+					var response remoteResponse[Y]
+					if err := decoder.Decode(&response); err != nil {
+						if errors.Is(err, io.EOF) {
+							err = io.ErrUnexpectedEOF
+						}
+						broken(fmt.Errorf("connection lost: %w", err))
+						return
+					}
+					for range response.Credit {
+						creditCh <- struct{}{}
+					}
+					var err error
+					if response.Err != "" {
+						err = errors.New(response.Err)
+					}
+					select {
+					case resultCh <- Data[Y]{response.Index, response.Item, err}:
+					case <-doneCh:
+						return
+					}
+				}
+			}()
+
+			// Emit the results in the order the items were sent
+			pending := make(map[int]Data[Y])
+			for input := range orderCh {
+				if passError(input, outputCh) {
+					continue
+				}
+				for {
+					if result, ok := pending[input.index]; ok {
+						delete(pending, input.index)
+						outputCh <- result
+						break
+					}
+					select {
+					case result := <-resultCh:
+						pending[result.index] = result
+						continue
+					case <-brokenCh:
+					}
+					fail(input.index, brokenErr)
+					drain(orderCh)
+					return
+				}
+			}
+		}()
+		return outputCh
+	}
+}
+
+func TestRemote() {
+	data := list.NumRange(1, 11)
+	ctx := context.Background()
+
+	dir, err := os.MkdirTemp("", "pipeline")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// The server side would normally be another process
+	serve := func(ctx context.Context, network, address string, codec Codec, pipe PipeFn[int, int], window int) (func(), error) {
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			Serve(ctx, listener, codec, pipe, window)
+		})
+		return func() {
+			cancel()
+			wg.Wait()
+		}, nil
+	}
+
+	collect := func(outputCh <-chan Data[int]) error {
+		fmt.Println(Collect(outputCh))
+		return nil
+	}
+
+	run(func() {
+		fmt.Println("Unix Socket (gob, parallel remote stage)")
+		address := filepath.Join(dir, "square.sock")
+		stop, err := serve(ctx, "unix", address, GobCodec{}, ParallelPipe(square, 4), 4)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer stop()
+
+		p := NewPipeline(NamedPipe("remote square", Remote[int, int]("unix", address, GobCodec{}))).
+			Then(NewStage("double", double))
+		ForEach(Remote[int, int]("unix", address, GobCodec{})(Generate(1, 2, 3)), func(i int, y int) {
+			fmt.Printf("%d: %d\n", i, y)
+		})
+		err = p.Run(ctx, Generate(data...), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Loopback TCP (JSON, window 2)")
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		address := listener.Addr().String()
+		listener.Close()
+		stop, err := serve(ctx, "tcp", address, JSONCodec{}, ParallelPipe(square, 4), 2)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer stop()
+
+		p := NewPipeline(NamedPipe("remote square", Remote[int, int]("tcp", address, JSONCodec{})))
+		err = p.Run(ctx, Generate(data...), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Connection Lost")
+		address := filepath.Join(dir, "lost.sock")
+		stop, err := serve(ctx, "unix", address, GobCodec{}, Pipe(square), 4)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		// Server goes away mid-run
+		time.AfterFunc(350*time.Millisecond, stop)
+
+		p := NewPipeline(NamedPipe("remote square", Remote[int, int]("unix", address, GobCodec{})))
+		err = p.Run(ctx, Generate(data...), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("No Server")
+		p := NewPipeline(NamedPipe("remote square", Remote[int, int]("unix", filepath.Join(dir, "missing.sock"), GobCodec{})))
+		err := p.Run(ctx, Generate(data...), collect)
+		fmt.Println("Error:", err)
+	})
+}
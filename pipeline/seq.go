@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Iterators skip errored items, like the sinks
+// Breaking out of the loop early calls cancel (to stop a context-aware source),
+// then drains the channel, so the upstream stages finish instead of leaking
+
+// Iterates over the items of the channel, in arrival order
+// cancel may be nil if the source is finite
+func ToSeq[T any](channel <-chan Data[T], cancel context.CancelFunc) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range ToSeq2(channel, cancel) {
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over the index and item of the channel, in arrival order
+func ToSeq2[T any](channel <-chan Data[T], cancel context.CancelFunc) iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		for data := range channel {
+			if data.err != nil {
+				continue
+			}
+			if !yield(data.index, data.item) {
+				if cancel != nil {
+					cancel()
+				}
+				drain(channel)
+				return
+			}
+		}
+	}
+}
+
+// Runs the pipeline, and iterates over the index and item of its output (in arrival order)
+// Breaking out of the loop stops the run; the iterator only returns after the run has finished
+// The returned function gives the run error after the loop (nil if stopped by break)
+func (p *Pipeline[X, Y]) All(ctx context.Context, source <-chan Data[X]) (iter.Seq2[int, Y], func() error) {
+	var runErr error
+	seq := func(yield func(int, Y) bool) {
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		itemCh := make(chan Data[Y])
+		doneCh := make(chan struct{})
+		go func() {
+			defer close(doneCh)
+			runErr = p.Run(runCtx, source, func(outputCh <-chan Data[Y]) error {
+				defer close(itemCh)
+				for data := range outputCh {
+					select {
+					case itemCh <- data:
+					case <-runCtx.Done():
+						return nil
+					}
+				}
+				return nil
+			})
+		}()
+
+		stopped := false
+		for data := range itemCh {
+			if !yield(data.index, data.item) {
+				stopped = true
+				cancel()
+				break
+			}
+		}
+		drain(itemCh)
+		<-doneCh
+		if stopped && errors.Is(runErr, context.Canceled) && ctx.Err() == nil {
+			runErr = nil
+		}
+	}
+	return seq, func() error {
+		return runErr
+	}
+}
+
+func TestSeq() {
+	data := list.NumRange(1, 11)
+
+	// Infinite iterator: 1, 2, 3, ...
+	naturals := func(yield func(int) bool) {
+		for x := 1; ; x++ {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+
+	run(func() {
+		fmt.Println("ToSeq")
+		for y := range ToSeq(Pipe(square)(Generate(data...)), nil) {
+			fmt.Println("Got:", y)
+		}
+	})
+
+	run(func() {
+		fmt.Println("ToSeq2 (break on infinite source)")
+		before := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		for i, y := range ToSeq2(Pipe(double)(FromSeq(ctx, naturals)), cancel) {
+			fmt.Printf("%d: %d\n", i, y)
+			if y >= 10 {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Println("Goroutines before:", before, "after:", runtime.NumGoroutine())
+	})
+
+	run(func() {
+		fmt.Println("Pipeline.All (break)")
+		p := NewPipeline(NewStage("square", square)).Then(NewStage("double", double))
+		seq, err := p.All(context.Background(), Generate(data...))
+		for i, y := range seq {
+			fmt.Printf("%d: %d\n", i, y)
+			if i >= 3 {
+				break
+			}
+		}
+		fmt.Println("Error:", err())
+	})
+
+	run(func() {
+		fmt.Println("FromSeq2")
+		ctx := context.Background()
+		words := []string{"apple", "banana", "cherry"}
+		out := Collect(Pipe(strings.ToUpper)(FromSeq2(ctx, slices.All(words))))
+		fmt.Println(out)
+	})
+}
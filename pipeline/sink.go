@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Sinks skip errored items; use Pipeline.Run to get the pipeline errors
+
+// Collects all items into a growable slice, ordered by index
+// Does not need the size up front, so it works even if stages drop or add items
+func Collect[T any](channel <-chan Data[T]) []T {
+	received := make([]Data[T], 0)
+	for data := range channel {
+		if data.err != nil {
+			continue
+		}
+		received = append(received, data)
+	}
+	slices.SortFunc(received, func(a, b Data[T]) int {
+		return a.index - b.index
+	})
+	output := make([]T, len(received))
+	for i, data := range received {
+		output[i] = data.item
+	}
+	return output
+}
+
+// Emits items in index order, as soon as the next contiguous index arrives
+// Out-of-order items are held in a buffer until the gap is filled;
+// if the input closes with gaps, the rest are flushed in index order
+func Stream[T any](channel <-chan Data[T]) <-chan T {
+	outputCh := make(chan T)
+	go func() {
+		next := 0
+		pending := make(map[int]Data[T])
+		for data := range channel {
+			pending[data.index] = data
+			for {
+				data, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if data.err == nil {
+					outputCh <- data.item
+				}
+				next += 1
+			}
+		}
+		// Flush leftovers (indices after a gap)
+		indexes := make([]int, 0, len(pending))
+		for index := range pending {
+			indexes = append(indexes, index)
+		}
+		slices.Sort(indexes)
+		for _, index := range indexes {
+			if data := pending[index]; data.err == nil {
+				outputCh <- data.item
+			}
+		}
+		close(outputCh)
+	}()
+	return outputCh
+}
+
+// Runs the callback for each item as it arrives
+// The next item is only received after the callback returns (backpressure)
+func ForEach[T any](channel <-chan Data[T], fn func(int, T)) {
+	for data := range channel {
+		if data.err != nil {
+			continue
+		}
+		fn(data.index, data.item)
+	}
+}
+
+func TestSinks() {
+	data := list.NumRange(1, 11)
+
+	run(func() {
+		fmt.Println("Collect")
+		in := Generate(data...)
+		out := Collect(Pipe(square)(in))
+		fmt.Println(out)
+	})
+
+	run(func() {
+		fmt.Println("Stream")
+		in := Generate(data...)
+		for item := range Stream(Pipe(double)(in)) {
+			fmt.Println("Received:", item)
+		}
+	})
+
+	run(func() {
+		fmt.Println("ForEach")
+		in := Generate(data...)
+		ForEach(Pipe(increment)(in), func(index int, item int) {
+			fmt.Printf("Item %d: %d\n", index, item)
+		})
+	})
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Sources stop and close their output when the context is cancelled
+// Read errors are sent downstream as an errored item, and the source stops
+
+// Emits the lines of the reader
+func Lines(ctx context.Context, reader io.Reader) <-chan Data[string] {
+	outputCh := make(chan Data[string])
+	go func() {
+		defer close(outputCh)
+		scanner := bufio.NewScanner(reader)
+		index := 0
+		for scanner.Scan() {
+			if !emit(ctx, outputCh, Data[string]{index, scanner.Text(), nil}) {
+				return
+			}
+			index += 1
+		}
+		if err := scanner.Err(); err != nil {
+			emit(ctx, outputCh, Data[string]{index, "", err})
+		}
+	}()
+	return outputCh
+}
+
+// Emits the records of the CSV file (including the header row, if any)
+func CSVRecords(ctx context.Context, path string) <-chan Data[[]string] {
+	outputCh := make(chan Data[[]string])
+	go func() {
+		defer close(outputCh)
+		file, err := os.Open(path)
+		if err != nil {
+			emit(ctx, outputCh, Data[[]string]{0, nil, err})
+			return
+		}
+		defer file.Close()
+
+		reader := csv.NewReader(file)
+		index := 0
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				emit(ctx, outputCh, Data[[]string]{index, nil, err})
+				return
+			}
+			if !emit(ctx, outputCh, Data[[]string]{index, record, nil}) {
+				return
+			}
+			index += 1
+		}
+	}()
+	return outputCh
+}
+
+// Emits the decoded records of the JSON Lines file (one JSON value per line)
+// Blank lines are skipped
+func JSONLines[T any](ctx context.Context, path string) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		defer close(outputCh)
+		var zero T
+		file, err := os.Open(path)
+		if err != nil {
+			emit(ctx, outputCh, Data[T]{0, zero, err})
+			return
+		}
+		defer file.Close()
+
+		// Stop the line reader if we return early
+		linesCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		index := 0
+		for data := range Lines(linesCtx, file) {
+			if data.err != nil {
+				emit(ctx, outputCh, Data[T]{index, zero, data.err})
+				return
+			}
+			if strings.TrimSpace(data.item) == "" {
+				continue
+			}
+			var record T
+			if err := json.Unmarshal([]byte(data.item), &record); err != nil {
+				err = fmt.Errorf("%s line %d: %w", path, data.index+1, err)
+				emit(ctx, outputCh, Data[T]{index, zero, err})
+				return
+			}
+			if !emit(ctx, outputCh, Data[T]{index, record, nil}) {
+				return
+			}
+			index += 1
+		}
+	}()
+	return outputCh
+}
+
+// Emits the items of the iterator
+func FromSeq[T any](ctx context.Context, seq iter.Seq[T]) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		defer close(outputCh)
+		index := 0
+		for item := range seq {
+			if !emit(ctx, outputCh, Data[T]{index, item, nil}) {
+				return
+			}
+			index += 1
+		}
+	}()
+	return outputCh
+}
+
+// Emits the items of the indexed iterator (e.g. slices.All), keeping the index
+func FromSeq2[T any](ctx context.Context, seq iter.Seq2[int, T]) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		defer close(outputCh)
+		for index, item := range seq {
+			if !emit(ctx, outputCh, Data[T]{index, item, nil}) {
+				return
+			}
+		}
+	}()
+	return outputCh
+}
+
+// Emits the items received from the channel, until it is closed
+func FromChannel[T any](ctx context.Context, channel <-chan T) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		defer close(outputCh)
+		index := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item, ok := <-channel:
+				if !ok {
+					return
+				}
+				if !emit(ctx, outputCh, Data[T]{index, item, nil}) {
+					return
+				}
+				index += 1
+			}
+		}
+	}()
+	return outputCh
+}
+
+// Emits fn(i) on every tick, for i = 0, 1, 2, ...
+// Runs until the context is cancelled, or count items have been emitted (if count > 0)
+func Ticker[T any](ctx context.Context, interval time.Duration, count int, fn func(int) T) <-chan Data[T] {
+	outputCh := make(chan Data[T])
+	go func() {
+		defer close(outputCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for index := 0; count <= 0 || index < count; index++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !emit(ctx, outputCh, Data[T]{index, fn(index), nil}) {
+					return
+				}
+			}
+		}
+	}()
+	return outputCh
+}
+
+// Sends the data, unless the context is cancelled first
+func emit[T any](ctx context.Context, outputCh chan<- Data[T], data Data[T]) bool {
+	select {
+	case outputCh <- data:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func TestSources() {
+	ctx := context.Background()
+	p := NewPipeline(NewStage("square", square))
+
+	collect := func(outputCh <-chan Data[int]) error {
+		fmt.Println(Collect(outputCh))
+		return nil
+	}
+
+	run(func() {
+		fmt.Println("Lines")
+		reader := strings.NewReader("apple\nbanana\ncherry")
+		q := NewPipeline(NewStage("length", func(line string) int {
+			return len(line)
+		}))
+		err := q.Run(ctx, Lines(ctx, reader), collect)
+		fmt.Println("Error:", err)
+	})
+
+	dir, err := os.MkdirTemp("", "pipeline")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	run(func() {
+		fmt.Println("CSV")
+		path := filepath.Join(dir, "numbers.csv")
+		os.WriteFile(path, []byte("1,2\n3,4\n5,6\n"), 0o644)
+		q := NewPipeline(NewStage("columns", func(record []string) int {
+			return len(record)
+		}))
+		err := q.Run(ctx, CSVRecords(ctx, path), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("JSON Lines (with bad line)")
+		path := filepath.Join(dir, "numbers.jsonl")
+		os.WriteFile(path, []byte("1\n2\n\n3\nfour\n5\n"), 0o644)
+		err := p.Run(ctx, JSONLines[int](ctx, path), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Missing File")
+		err := p.Run(ctx, JSONLines[int](ctx, filepath.Join(dir, "missing.jsonl")), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Seq")
+		err := p.Run(ctx, FromSeq(ctx, func(yield func(int) bool) {
+			for x := 1; x <= 5; x++ {
+				if !yield(x) {
+					return
+				}
+			}
+		}), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Channel")
+		channel := make(chan int)
+		go func() {
+			for _, x := range list.NumRange(1, 6) {
+				channel <- x
+			}
+			close(channel)
+		}()
+		err := p.Run(ctx, FromChannel(ctx, channel), collect)
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Ticker")
+		tickCtx, cancel := context.WithTimeout(ctx, 550*time.Millisecond)
+		defer cancel()
+		source := Ticker(tickCtx, 100*time.Millisecond, 0, func(i int) int {
+			return i + 1
+		})
+		err := p.Run(tickCtx, source, collect)
+		fmt.Println("Error:", err)
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/roidaradal/fn/list"
+	"github.com/roidaradal/go-patterns/watchdog"
+)
+
+// Returns a copy of the stage whose output is watched
+// Its input is guarded, so that the stages before it can finish even if it wedges
+func (s Stage[X, Y]) Watched(w *watchdog.Watchdog) Stage[X, Y] {
+	return Stage[X, Y]{s.name, func(inputCh <-chan Data[X]) <-chan Data[Y] {
+		return watchdog.Watch(w, s.name, s.pipe(watchdog.Guard(w, inputCh)))
+	}}
+}
+
+func TestWatchdog() {
+	data := list.NumRange(1, 11)
+
+	// Stage that wedges: after 3 items, it sends to a side channel nobody reads
+	stuck := func(inputCh <-chan Data[int]) <-chan Data[int] {
+		outputCh := make(chan Data[int])
+		sideCh := make(chan int)
+		go func() {
+			for input := range inputCh {
+				if input.index >= 3 {
+					sideCh <- input.item
+				}
+				outputCh <- input
+			}
+			close(outputCh)
+		}()
+		return outputCh
+	}
+
+	run(func() {
+		fmt.Println("Watchdog (fail fast)")
+		w := watchdog.New(time.Second, true)
+		ctx, stop := w.Start(context.Background())
+		defer stop()
+
+		p := NewPipeline(NewStage("square", square).Watched(w)).
+			Then(NamedPipe("stuck", stuck).Watched(w)).
+			Then(NewStage("double", double).Watched(w))
+
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			fmt.Println(Collect(outputCh))
+			return nil
+		})
+		fmt.Println("Error:", err)
+	})
+	run(func() {
+		fmt.Println("Watchdog (report only, stages watched before Start)")
+		w := watchdog.New(time.Second, false).OnStall(func(err *watchdog.StallError) {
+			fmt.Printf("[Watchdog] No progress for %v\n", err.Idle.Round(time.Millisecond))
+		})
+		p := NewPipeline(NewStage("square", square).Watched(w)).
+			Then(NamedPipe("stuck", stuck).Watched(w)).
+			Then(NewStage("double", double).Watched(w))
+
+		// Without fail fast, the run is ended by its deadline
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		ctx, stop := w.Start(ctx)
+		defer stop()
+
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			fmt.Println(Collect(outputCh))
+			return nil
+		})
+		fmt.Println("Error:", err)
+	})
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type OptFunc[T any] func(*T)
+
+// Window of items, by event time: [Start, End)
+type Window[T any] struct {
+	Start time.Time
+	End   time.Time
+	Items []T
+	Late  bool // re-emitted because late events arrived after the window first fired
+}
+
+// Returns the windows output and the late side output
+// Both outputs must be consumed concurrently
+type WindowFn[T any] = func(<-chan Data[T]) (<-chan Data[Window[T]], <-chan Data[T])
+
+type windowConfig struct {
+	outOfOrder  time.Duration
+	lateness    time.Duration
+	idleTimeout time.Duration
+	clock       Clock
+}
+
+// Watermark trails the maximum event time seen by this much,
+// to give out-of-order events time to arrive before a window fires
+func WithOutOfOrder(outOfOrder time.Duration) OptFunc[windowConfig] {
+	return func(cfg *windowConfig) {
+		cfg.outOfOrder = outOfOrder
+	}
+}
+
+// Fired windows still accept late events until the watermark passes End + lateness;
+// the updated window is re-emitted. Events later than that go to the late side output
+func WithLateness(lateness time.Duration) OptFunc[windowConfig] {
+	return func(cfg *windowConfig) {
+		cfg.lateness = lateness
+	}
+}
+
+// If no events arrive for this long (by the clock), the watermark is moved forward
+// by the idle time, so that open windows still fire on a quiet stream
+func WithIdleTimeout(idleTimeout time.Duration) OptFunc[windowConfig] {
+	return func(cfg *windowConfig) {
+		cfg.idleTimeout = idleTimeout
+	}
+}
+
+func WithClock(clock Clock) OptFunc[windowConfig] {
+	return func(cfg *windowConfig) {
+		cfg.clock = clock
+	}
+}
+
+// Fixed-size, non-overlapping windows
+// Panics if size is not positive
+func TumblingWindow[T any](size time.Duration, timestamp func(T) time.Time, options ...OptFunc[windowConfig]) WindowFn[T] {
+	if size <= 0 {
+		panic(fmt.Sprintf("TumblingWindow: size %v must be positive", size))
+	}
+	assign := func(t time.Time) []span {
+		start := t.Truncate(size)
+		return []span{{start, start.Add(size)}}
+	}
+	return eventWindows(timestamp, assign, false, options)
+}
+
+// Fixed-size windows that start every slide; an event can belong to several windows
+// Panics unless 0 < slide <= size, so that every event belongs to at least one window
+func SlidingWindow[T any](size time.Duration, slide time.Duration, timestamp func(T) time.Time, options ...OptFunc[windowConfig]) WindowFn[T] {
+	if slide <= 0 || slide > size {
+		panic(fmt.Sprintf("SlidingWindow: slide %v must be in (0, size %v]", slide, size))
+	}
+	assign := func(t time.Time) []span {
+		spans := make([]span, 0)
+		for start := t.Truncate(slide); start.Add(size).After(t); start = start.Add(-slide) {
+			spans = append(spans, span{start, start.Add(size)})
+		}
+		slices.Reverse(spans)
+		return spans
+	}
+	return eventWindows(timestamp, assign, false, options)
+}
+
+// Windows of activity: a session closes after a gap with no events
+func SessionWindow[T any](gap time.Duration, timestamp func(T) time.Time, options ...OptFunc[windowConfig]) WindowFn[T] {
+	assign := func(t time.Time) []span {
+		return []span{{t, t.Add(gap)}}
+	}
+	return eventWindows(timestamp, assign, true, options)
+}
+
+type span struct {
+	start time.Time
+	end   time.Time
+}
+
+type openWindow[T any] struct {
+	Window[T]
+	fired   bool
+	updated bool
+}
+
+func eventWindows[T any](timestamp func(T) time.Time, assign func(time.Time) []span, merge bool, options []OptFunc[windowConfig]) WindowFn[T] {
+	cfg := &windowConfig{clock: realClock{}}
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return func(inputCh <-chan Data[T]) (<-chan Data[Window[T]], <-chan Data[T]) {
+		outputCh := make(chan Data[Window[T]])
+		lateCh := make(chan Data[T])
+		go func() {
+			index := 0
+			open := make([]*openWindow[T], 0)
+			var watermark time.Time
+			hasWatermark := false
+
+			emit := func(w *openWindow[T], late bool) {
+				window := Window[T]{w.Start, w.End, slices.Clone(w.Items), late}
+				outputCh <- Data[Window[T]]{index, window, nil}
+				index += 1
+			}
+
+			// Fires the windows that the watermark has passed,
+			// and drops the ones that can no longer receive late events
+			advance := func() {
+				slices.SortFunc(open, func(a, b *openWindow[T]) int {
+					return a.End.Compare(b.End)
+				})
+				remaining := open[:0]
+				for _, w := range open {
+					if !w.End.After(watermark) {
+						if !w.fired || w.updated {
+							emit(w, w.fired)
+						}
+						w.fired, w.updated = true, false
+					}
+					if w.End.Add(cfg.lateness).After(watermark) {
+						remaining = append(remaining, w)
+					}
+				}
+				open = remaining
+			}
+
+			add := func(item T, s span) {
+				if merge {
+					// Session: absorb all the windows that overlap the new span
+					merged := &openWindow[T]{Window: Window[T]{Start: s.start, End: s.end}, updated: true}
+					remaining := open[:0]
+					for _, w := range open {
+						if w.Start.Before(merged.End) && merged.Start.Before(w.End) {
+							merged.Start = minTime(merged.Start, w.Start)
+							merged.End = maxTime(merged.End, w.End)
+							merged.Items = append(merged.Items, w.Items...)
+							merged.fired = merged.fired || w.fired
+						} else {
+							remaining = append(remaining, w)
+						}
+					}
+					merged.Items = append(merged.Items, item)
+					open = append(remaining, merged)
+					return
+				}
+				for _, w := range open {
+					if w.Start.Equal(s.start) && w.End.Equal(s.end) {
+						w.Items = append(w.Items, item)
+						w.updated = true
+						return
+					}
+				}
+				window := Window[T]{Start: s.start, End: s.end, Items: []T{item}}
+				open = append(open, &openWindow[T]{window, false, true})
+			}
+
+			// Re-armed on every event, so it only fires after a full idle period
+			var idleCh <-chan time.Time
+
+		loop:
+			for {
+				select {
+				case input, ok := <-inputCh:
+					if !ok {
+						break loop
+					}
+					if passErrorAt(input, outputCh, &index) {
+						continue
+					}
+					t := timestamp(input.item)
+					accepted := false
+					for _, s := range assign(t) {
+						if hasWatermark && !s.end.Add(cfg.lateness).After(watermark) {
+							continue // too late for this window
+						}
+						add(input.item, s)
+						accepted = true
+					}
+					if !accepted {
+						lateCh <- input
+					}
+
+					eventWatermark := t.Add(-cfg.outOfOrder)
+					if !hasWatermark || eventWatermark.After(watermark) {
+						watermark, hasWatermark = eventWatermark, true
+					}
+					advance()
+
+					if cfg.idleTimeout > 0 {
+						idleCh = cfg.clock.After(cfg.idleTimeout)
+					}
+				case <-idleCh:
+					idleCh = nil
+					watermark = watermark.Add(cfg.idleTimeout)
+					advance()
+					if len(open) > 0 {
+						idleCh = cfg.clock.After(cfg.idleTimeout)
+					}
+				}
+			}
+
+			// Input closed: fire everything that is still open
+			slices.SortFunc(open, func(a, b *openWindow[T]) int {
+				return a.Start.Compare(b.Start)
+			})
+			for _, w := range open {
+				if !w.fired || w.updated {
+					emit(w, w.fired)
+				}
+			}
+			close(outputCh)
+			close(lateCh)
+		}()
+		return outputCh, lateCh
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+type event struct {
+	name string
+	at   time.Time
+}
+
+func TestWindows() {
+	start := time.Date(2025, 10, 27, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+	// Out of order: c and f arrive late
+	events := []event{
+		{"a", at(1)}, {"b", at(3)}, {"d", at(6)}, {"c", at(4)},
+		{"e", at(11)}, {"f", at(2)}, {"g", at(13)}, {"h", at(31)},
+	}
+	timestamp := func(e event) time.Time {
+		return e.at
+	}
+
+	display := func(windowFn WindowFn[event]) {
+		outputCh, lateCh := windowFn(Generate(events...))
+		var late []event
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			late = Collect(lateCh)
+		})
+		for _, w := range Collect(outputCh) {
+			names := make([]string, len(w.Items))
+			for i, e := range w.Items {
+				names[i] = e.name
+			}
+			flag := ""
+			if w.Late {
+				flag = " (late update)"
+			}
+			fmt.Printf("[%s, %s) %v%s\n", w.Start.Format("15:04:05"), w.End.Format("15:04:05"), names, flag)
+		}
+		wg.Wait()
+		for _, e := range late {
+			fmt.Printf("Late: %s at %s\n", e.name, e.at.Format("15:04:05"))
+		}
+	}
+
+	run(func() {
+		fmt.Println("Tumbling (5s, out-of-order 1s, lateness 3s)")
+		display(TumblingWindow(5*time.Second, timestamp, WithOutOfOrder(time.Second), WithLateness(3*time.Second)))
+	})
+
+	run(func() {
+		fmt.Println("Sliding (10s every 5s)")
+		display(SlidingWindow(10*time.Second, 5*time.Second, timestamp, WithOutOfOrder(time.Second)))
+	})
+
+	run(func() {
+		fmt.Println("Session (gap 4s, lateness 10s)")
+		display(SessionWindow(4*time.Second, timestamp, WithLateness(10*time.Second)))
+	})
+
+	run(func() {
+		fmt.Println("Idle Timeout (manual clock)")
+		clock := NewManualClock(start)
+		inputCh := make(chan Data[event])
+		outputCh, lateCh := TumblingWindow(5*time.Second, timestamp, WithIdleTimeout(10*time.Second), WithClock(clock))(inputCh)
+		go func() {
+			for range lateCh {
+			}
+		}()
+		inputCh <- Data[event]{0, event{"a", at(1)}, nil}
+		inputCh <- Data[event]{1, event{"b", at(2)}, nil}
+		clock.BlockUntil(2) // one timer per event
+		clock.Advance(10 * time.Second)
+		w := <-outputCh
+		fmt.Printf("Fired after idle: %d items\n", len(w.item.Items))
+		close(inputCh)
+		for range outputCh {
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/roidaradal/fn/list"
+)
+
+// Writer sinks write items in arrival order, and return the number of items written
+// and the first error (an errored item or a write error)
+// After the first error, nothing else is written, but the channel is still drained
+// so that the upstream stages can finish
+
+// Writes one formatted line per item
+func WriteLines[T any](channel <-chan Data[T], w io.Writer, format func(T) string) (int, error) {
+	writer := bufio.NewWriter(w)
+	count, err := drainWrite(channel, func(item T) error {
+		_, err := fmt.Fprintln(writer, format(item))
+		return err
+	})
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	return count, err
+}
+
+// Writes one JSON value per line to the file
+// The file is only replaced (atomic rename) if everything was written successfully
+func WriteJSONLinesFile[T any](channel <-chan Data[T], path string) (int, error) {
+	return atomicWrite(path, func(w io.Writer) (int, error) {
+		encoder := json.NewEncoder(w)
+		return drainWrite(channel, func(item T) error {
+			return encoder.Encode(item)
+		})
+	})
+}
+
+// Writes the header (if not empty) and one CSV record per item to the file
+// The file is only replaced (atomic rename) if everything was written successfully
+func WriteCSVFile[T any](channel <-chan Data[T], path string, header []string, record func(T) []string) (int, error) {
+	return atomicWrite(path, func(w io.Writer) (int, error) {
+		writer := csv.NewWriter(w)
+		if len(header) > 0 {
+			if err := writer.Write(header); err != nil {
+				return drainWrite(channel, func(T) error { return err })
+			}
+		}
+		count, err := drainWrite(channel, func(item T) error {
+			return writer.Write(record(item))
+		})
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+		return count, err
+	})
+}
+
+// Appends one formatted line per item to the log file
+// When the file would exceed maxBytes, it is rotated: path => path.1 => path.2 ...,
+// keeping at most maxFiles old files
+func AppendRotating[T any](channel <-chan Data[T], path string, maxBytes int64, maxFiles int, format func(T) string) (int, error) {
+	log := &rotatingLog{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	count, err := drainWrite(channel, func(item T) error {
+		return log.WriteLine(format(item))
+	})
+	if closeErr := log.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
+
+// Writes each item, stops writing at the first error but keeps draining the channel
+func drainWrite[T any](channel <-chan Data[T], write func(T) error) (int, error) {
+	count := 0
+	var firstErr error
+	for data := range channel {
+		if firstErr != nil {
+			continue
+		}
+		if data.err != nil {
+			firstErr = data.err
+			continue
+		}
+		if err := write(data.item); err != nil {
+			firstErr = err
+			continue
+		}
+		count += 1
+	}
+	return count, firstErr
+}
+
+// Writes to a temp file in the same folder, then renames it to path on success
+// On failure, the temp file is removed and the original file (if any) is untouched
+func atomicWrite(path string, write func(io.Writer) (int, error)) (int, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	tempPath := file.Name()
+
+	writer := bufio.NewWriter(file)
+	count, err := write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp makes the file private: keep the existing file's mode, or use 0644
+		mode := os.FileMode(0o644)
+		if info, statErr := os.Stat(path); statErr == nil {
+			mode = info.Mode().Perm()
+		}
+		err = os.Chmod(tempPath, mode)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return count, err
+	}
+	return count, nil
+}
+
+type rotatingLog struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func (l *rotatingLog) WriteLine(line string) error {
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+	line += "\n"
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *rotatingLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Shifts path.N-1 => path.N, ..., path => path.1, then opens a fresh file
+func (l *rotatingLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	if l.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func TestWriters() {
+	ctx := context.Background()
+	data := list.NumRange(1, 11)
+	p := NewPipeline(NewStage("square", square))
+
+	dir, err := os.MkdirTemp("", "pipeline")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	showFile := func(path string) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("%s:\n%s", filepath.Base(path), content)
+	}
+
+	run(func() {
+		fmt.Println("Write Lines")
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			count, err := WriteLines(outputCh, os.Stdout, func(x int) string {
+				return fmt.Sprintf("Line: %d", x)
+			})
+			fmt.Println("Written:", count)
+			return err
+		})
+		fmt.Println("Error:", err)
+	})
+
+	run(func() {
+		fmt.Println("Write JSON Lines")
+		path := filepath.Join(dir, "squares.jsonl")
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			count, err := WriteJSONLinesFile(outputCh, path)
+			fmt.Println("Written:", count)
+			return err
+		})
+		fmt.Println("Error:", err)
+		showFile(path)
+	})
+
+	run(func() {
+		fmt.Println("Write CSV (with error)")
+		path := filepath.Join(dir, "squares.csv")
+		source := JSONLines[int](ctx, filepath.Join(dir, "missing.jsonl"))
+		count, err := WriteCSVFile(Pipe(square)(source), path, []string{"square"}, func(x int) []string {
+			return []string{fmt.Sprint(x)}
+		})
+		fmt.Println("Written:", count)
+		fmt.Println("Error:", err)
+		_, err = os.Stat(path)
+		fmt.Println("File exists:", err == nil)
+	})
+
+	run(func() {
+		fmt.Println("Append Rotating")
+		path := filepath.Join(dir, "squares.log")
+		err := p.Run(ctx, Generate(data...), func(outputCh <-chan Data[int]) error {
+			count, err := AppendRotating(outputCh, path, 40, 2, func(x int) string {
+				return fmt.Sprintf("square=%d", x)
+			})
+			fmt.Println("Written:", count)
+			return err
+		})
+		fmt.Println("Error:", err)
+		entries, _ := os.ReadDir(dir)
+		names := make([]string, 0)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "squares.log") {
+				names = append(names, entry.Name())
+			}
+		}
+		fmt.Println("Files:", names)
+		showFile(path)
+	})
+}
@@ -0,0 +1,277 @@
+// Opt-in stall detector for channel-based patterns (pipelines, worker pools, fan-in/fan-out)
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watched points (stages, workers) report what they are waiting on and when items move
+// If no item moves through any point for the timeout, the watchdog reports a StallError
+// with the state of all points and the blocked goroutines to the OnStall callback;
+// with failFast, it also cancels the run's context with the StallError,
+// so the run fails with a diagnostic instead of hanging
+type Watchdog struct {
+	mu       sync.Mutex
+	timeout  time.Duration
+	failFast bool
+	onStall  func(*StallError)
+	stopCh   chan struct{} // closed when the Start context is done
+	stopOnce sync.Once
+	lastMove time.Time
+	stalled  bool
+	points   []*watchPoint
+}
+
+type watchPoint struct {
+	name  string
+	op    string // what the point is waiting on
+	since time.Time
+	moved int
+	done  bool
+}
+
+type StallError struct {
+	Idle   time.Duration
+	Report string
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("stalled: no progress for %v\n%s", e.Idle.Round(time.Millisecond), e.Report)
+}
+
+// Panics if the timeout is not positive
+func New(timeout time.Duration, failFast bool) *Watchdog {
+	if timeout <= 0 {
+		panic(fmt.Sprintf("watchdog.New: timeout %v must be positive", timeout))
+	}
+	return &Watchdog{
+		timeout:  timeout,
+		failFast: failFast,
+		stopCh:   make(chan struct{}),
+		points:   make([]*watchPoint, 0),
+	}
+}
+
+// Called with the diagnostic on each stall; set before Start
+func (w *Watchdog) OnStall(fn func(*StallError)) *Watchdog {
+	w.onStall = fn
+	return w
+}
+
+// Starts watching; the returned context is cancelled with a StallError on a stall (if failFast)
+// Watch and Guard relays are released when this context is done, whether they were created
+// before or after Start; call Start once, and call stop when the run is done
+func (w *Watchdog) Start(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	w.mu.Lock()
+	w.lastMove = time.Now()
+	w.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(w.timeout / 4)
+		defer ticker.Stop()
+		defer w.stopOnce.Do(func() {
+			close(w.stopCh)
+		})
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				idle, stalled := w.check()
+				if !stalled {
+					continue
+				}
+				stallErr := &StallError{idle, w.Report()}
+				if w.onStall != nil {
+					w.onStall(stallErr)
+				}
+				if w.failFast {
+					cancel(stallErr)
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() {
+		cancel(nil)
+	}
+}
+
+// Point is about to wait on op (e.g. "send", "receive")
+func (w *Watchdog) Waiting(name string, op string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := w.point(name)
+	p.op = op
+	p.since = time.Now()
+}
+
+// Point has moved an item
+func (w *Watchdog) Moved(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := w.point(name)
+	p.moved += 1
+	p.op = ""
+	w.lastMove = time.Now()
+}
+
+// Point has finished
+func (w *Watchdog) Done(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := w.point(name)
+	p.done = true
+	p.op = ""
+	w.lastMove = time.Now()
+}
+
+// State of all points, and the goroutines blocked on channel operations
+func (w *Watchdog) Report() string {
+	w.mu.Lock()
+	var sb strings.Builder
+	now := time.Now()
+	for _, p := range w.points {
+		state := "done"
+		if !p.done {
+			state = "busy"
+			if p.op != "" {
+				state = fmt.Sprintf("waiting on %s for %v", p.op, now.Sub(p.since).Round(time.Millisecond))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("  %-12s %s (moved %d)\n", p.name, state, p.moved))
+	}
+	w.mu.Unlock()
+
+	blocked := blockedGoroutines()
+	if len(blocked) > 0 {
+		sb.WriteString("  Blocked goroutines:\n")
+		for _, line := range blocked {
+			sb.WriteString("    " + line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// Relays the channel, reporting progress as the named point
+// When the Start context is done, closes the output and drains the input,
+// so that the upstream goroutines can still finish
+func Watch[T any](w *Watchdog, name string, inputCh <-chan T) <-chan T {
+	w.mu.Lock()
+	w.point(name)
+	w.mu.Unlock()
+	return relay(w, inputCh, func(op string) {
+		w.Waiting(name, op)
+	}, func() {
+		w.Moved(name)
+	}, func() {
+		w.Done(name)
+	})
+}
+
+// Relays the channel without reporting progress, and is released like Watch on cancellation
+// Put in front of a stage that may wedge, so the stages upstream of it can still finish
+func Guard[T any](w *Watchdog, inputCh <-chan T) <-chan T {
+	return relay(w, inputCh, func(string) {}, func() {}, func() {})
+}
+
+func relay[T any](w *Watchdog, inputCh <-chan T, waiting func(string), moved func(), done func()) <-chan T {
+	outputCh := make(chan T)
+	go func() {
+		defer done()
+		for {
+			waiting("receive")
+			var item T
+			var ok bool
+			select {
+			case item, ok = <-inputCh:
+			case <-w.stopCh:
+				close(outputCh)
+				drain(inputCh)
+				return
+			}
+			if !ok {
+				close(outputCh)
+				return
+			}
+			waiting("send")
+			select {
+			case outputCh <- item:
+			case <-w.stopCh:
+				close(outputCh)
+				drain(inputCh)
+				return
+			}
+			moved()
+		}
+	}()
+	return outputCh
+}
+
+// Stalled if there are active points, and nothing moved for the timeout
+// Reports only once per stall
+func (w *Watchdog) check() (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	idle := time.Since(w.lastMove)
+	if idle < w.timeout {
+		w.stalled = false
+		return idle, false
+	}
+	active := false
+	for _, p := range w.points {
+		active = active || !p.done
+	}
+	if !active || w.stalled {
+		return idle, false
+	}
+	w.stalled = true
+	return idle, true
+}
+
+func (w *Watchdog) point(name string) *watchPoint {
+	for _, p := range w.points {
+		if p.name == name {
+			return p
+		}
+	}
+	p := &watchPoint{name: name, since: time.Now()}
+	w.points = append(w.points, p)
+	return p
+}
+
+// Receives the rest of the input without forwarding
+func drain[T any](inputCh <-chan T) {
+	for range inputCh {
+	}
+}
+
+// Header and top function of goroutines blocked on channel send, receive or select
+func blockedGoroutines() []string {
+	buffer := make([]byte, 1<<20)
+	buffer = buffer[:runtime.Stack(buffer, true)]
+	lines := make([]string, 0)
+	for _, block := range bytes.Split(buffer, []byte("\n\n")) {
+		frames := strings.Split(string(block), "\n")
+		header := frames[0]
+		if !strings.Contains(header, "[chan send") && !strings.Contains(header, "[chan receive") && !strings.Contains(header, "[select") {
+			continue
+		}
+		top := ""
+		for _, frame := range frames[1:] {
+			if !strings.HasPrefix(frame, "runtime.") && !strings.HasPrefix(frame, "\t") {
+				top = frame
+				break
+			}
+		}
+		lines = append(lines, strings.TrimSuffix(header, ":")+" "+top)
+	}
+	return lines
+}
@@ -8,7 +8,8 @@ import (
 )
 
 func main() {
-	TestPool()
+	// TestPool()
+	TestWatchdog()
 }
 
 func run(task func()) {
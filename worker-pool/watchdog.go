@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/go-patterns/watchdog"
+)
+
+// ConcurrentWorkers, with each worker watched by the watchdog
+// Returns the partial result and the cause if the context is cancelled (e.g. StallError)
+func WatchedWorkers[I any, O any](ctx context.Context, w *watchdog.Watchdog, items []I, fn DataFn[I, O], numWorkers int) (*Result[I, O], error) {
+	// Input and output channels
+	inputCh := make(chan Input[I])
+	outputCh := make(chan Output[O], numWorkers) // buffered, otherwise deadlocks
+
+	// Worker function: reports what it is waiting on, and each finished job
+	worker := func(id int) {
+		name := fmt.Sprintf("worker %d", id)
+		defer w.Done(name)
+		for {
+			w.Waiting(name, "receive input")
+			var input Input[I]
+			var ok bool
+			select {
+			case input, ok = <-inputCh:
+			case <-ctx.Done():
+				return
+			}
+			if !ok {
+				return
+			}
+			w.Waiting(name, "task")
+			out, err := fn(input.item)
+			w.Waiting(name, "send output")
+			select {
+			case outputCh <- Output[O]{input.index, out, err}:
+			case <-ctx.Done():
+				return
+			}
+			w.Moved(name)
+		}
+	}
+
+	// Spawn the workers
+	var wg sync.WaitGroup
+	for id := range numWorkers {
+		wg.Go(func() {
+			worker(id)
+		})
+	}
+
+	// Feed the input data to input channel
+	go func() {
+		defer close(inputCh)
+		for i, item := range items {
+			select {
+			case inputCh <- Input[I]{i, item}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Wait for all workers to finish, close the output channel
+	go func() {
+		wg.Wait()
+		close(outputCh)
+	}()
+
+	// Get the results, or stop if the run is cancelled
+	result := NewResult[I, O]()
+	for {
+		select {
+		case out, ok := <-outputCh:
+			if !ok {
+				return result, nil
+			}
+			if out.err == nil {
+				result.success += 1
+				result.output[out.index] = out.item
+			} else {
+				result.errors[out.index] = out.err
+			}
+		case <-ctx.Done():
+			return result, context.Cause(ctx)
+		}
+	}
+}
+
+func TestWatchdog() {
+	data := []int{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Square that hangs on 5, waiting on a channel nobody sends to
+	stuckSquare := func(x int) (int, error) {
+		if x == 5 {
+			<-make(chan struct{})
+		}
+		return Square(x)
+	}
+
+	run(func() {
+		fmt.Println("Watched Workers (fail fast)")
+		w := watchdog.New(2*time.Second, true)
+		ctx, stop := w.Start(context.Background())
+		defer stop()
+		result, err := WatchedWorkers(ctx, w, data, stuckSquare, 4)
+		result.Display(data)
+		fmt.Println("Error:", err)
+	})
+}